@@ -5,11 +5,11 @@ import (
 	"fmt"
 	"godex/internal/config"
 	"godex/internal/downloader"
+	"godex/internal/httpclient"
 	"godex/internal/mangadex"
 	"log"
 	"os"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/spf13/cobra"
 )
 
@@ -20,8 +20,6 @@ var (
 		Short: "Downloads all available chapters of a manga based on a url passed",
 		Run: func(cmd *cobra.Command, args []string) {
 			ctx := context.Background()
-			// Initialize Resty client
-			httpClient := resty.New()
 			// Load config
 			configExists, err := config.ConfigExists()
 			if err != nil {
@@ -38,23 +36,33 @@ var (
 				log.Fatalf("Cannot run godex, issue when loading configuration :%v", err)
 			}
 
+			applyImageQuality(cfg)
+
+			// Initialize the rate limited Resty client
+			httpClient := httpclient.New(cfg)
+
 			// Create a new MangaDex client
-			client := mangadex.NewClient(cfg, httpClient)
+			client := mangadex.NewClient(cfg, httpClient, config.SessionStore{})
 
-			loginInfo, err := client.Login(ctx)
+			// Login to MangaDex, reusing the saved session when possible
+			err = client.Authenticate(ctx)
 			if err != nil {
 				log.Fatalf("Error logging in to MangaDex: %v", err)
 			}
-			// Set the client to use the login info
-			client.SetAuthToken(loginInfo.AccessToken)
 
 			manga, err := client.GetMangaChapters(ctx, mangaUrl)
 			if err != nil {
 				log.Fatalf("Error loading list of manga chapters: %v", err)
 			}
 
+			lib := openLibrary()
+			defer lib.Close()
+
 			// Create a new downloader
-			downloader := downloader.NewDownloader(cfg, httpClient)
+			downloader, err := downloader.NewDownloader(cfg, httpClient, lib)
+			if err != nil {
+				log.Fatalf("Error creating downloader: %v", err)
+			}
 
 			// Download the manga
 			err = downloader.DownloadManga(ctx, []*mangadex.GodexManga{manga}, client)
@@ -68,4 +76,5 @@ var (
 
 func init() {
 	completeCmd.Flags().StringVarP(&mangaUrl, "url", "u", "", "Url of the manga to download")
+	completeCmd.Flags().StringVarP(&imageQuality, "quality", "q", "", "Quality of the downloaded pages, either data or data-saver")
 }
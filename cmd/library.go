@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"godex/internal/config"
+	"godex/internal/downloader"
+	"godex/internal/httpclient"
+	"godex/internal/mangadex"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	dryRun     bool
+	rollback   bool
+	libraryCmd = &cobra.Command{
+		Use:   "library",
+		Short: "Manages the downloaded manga",
+	}
+	renameCmd = &cobra.Command{
+		Use:   "rename",
+		Short: "Moves the downloaded chapters to the paths given by the configured template",
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+			// Load config
+			configExists, err := config.ConfigExists()
+			if err != nil {
+				log.Fatalf("Error checking if godex config exists: %v", err)
+			}
+
+			if !configExists {
+				fmt.Println("Cannot run godex, there's no configuration available. \nPlease run either godex prompt or godex load")
+				os.Exit(0)
+			}
+
+			cfg, err := config.LoadConfig()
+			if err != nil {
+				log.Fatalf("Cannot run godex, issue when loading configuration :%v", err)
+			}
+
+			lib := openLibrary()
+			defer lib.Close()
+
+			journalPath, err := config.RenameJournalPath()
+			if err != nil {
+				log.Fatalf("Error locating the rename journal: %v", err)
+			}
+
+			httpClient := httpclient.New(cfg)
+			downloader, err := downloader.NewDownloader(cfg, httpClient, lib)
+			if err != nil {
+				log.Fatalf("Error creating downloader: %v", err)
+			}
+
+			if rollback {
+				err = downloader.RollbackRenames(ctx, journalPath)
+				if err != nil {
+					log.Fatalf("Error rolling back the last rename: %v", err)
+				}
+				log.Println("Rolled back the last rename successfully")
+				return
+			}
+
+			// Archives the library doesn't know about are looked up on MangaDex
+			client := mangadex.NewClient(cfg, httpClient, config.SessionStore{})
+			err = client.Authenticate(ctx)
+			if err != nil {
+				log.Fatalf("Error logging in to MangaDex: %v", err)
+			}
+
+			renames, skipped, err := downloader.PlanRenames(ctx, client)
+			if err != nil {
+				log.Fatalf("Error planning renames: %v", err)
+			}
+			for _, skip := range skipped {
+				fmt.Printf("Skipping %v\n", skip)
+			}
+			for _, rename := range renames {
+				fmt.Printf("%v -> %v\n", rename.From, rename.To)
+			}
+			if dryRun || len(renames) == 0 {
+				fmt.Printf("%v chapters to move, %v skipped\n", len(renames), len(skipped))
+				return
+			}
+
+			err = downloader.ApplyRenames(ctx, renames, journalPath)
+			if err != nil {
+				log.Fatalf("Error renaming chapters, run godex library rename --rollback to undo: %v", err)
+			}
+			log.Printf("Moved %v chapters successfully, run godex library rename --rollback to undo", len(renames))
+		},
+	}
+)
+
+func init() {
+	renameCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Only print the chapters that would be moved")
+	renameCmd.Flags().BoolVar(&rollback, "rollback", false, "Move the chapters of the last rename back where they were")
+	libraryCmd.AddCommand(renameCmd)
+}
@@ -5,21 +5,23 @@ import (
 	"fmt"
 	"godex/internal/config"
 	"godex/internal/downloader"
+	"godex/internal/httpclient"
+	"godex/internal/library"
 	"godex/internal/mangadex"
 	"log"
 	"os"
+	"time"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/spf13/cobra"
 )
 
+var imageQuality string
+
 var rootCmd = &cobra.Command{
 	Use:   "godex",
 	Short: "Godex is a command line tool for downloading manga",
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := context.Background()
-		// Initialize Resty client
-		httpClient := resty.New()
 		// Load config
 		configExists, err := config.ConfigExists()
 		if err != nil {
@@ -36,50 +38,126 @@ var rootCmd = &cobra.Command{
 			log.Fatalf("Cannot run godex, issue when loading configuration :%v", err)
 		}
 
-		// Get the last run time
-		lastRanAt, err := config.LoadTimestamp()
+		applyImageQuality(cfg)
+
+		lib := openLibrary()
+		defer lib.Close()
+
+		// Get the last sync time, falling back on the timestamp file used before the library
+		syncStartedAt := time.Now()
+		lastRanAt, synced, err := lib.LastSyncedAt(ctx)
 		if err != nil {
-			log.Fatalf("Error loading last run timestamp: %v", err)
+			log.Fatalf("Error loading last sync time: %v", err)
+		}
+		if !synced {
+			lastRanAt, err = config.LoadTimestamp()
+			if err != nil {
+				log.Fatalf("Error loading last run timestamp: %v", err)
+			}
 		}
 
+		// Initialize the rate limited Resty client
+		httpClient := httpclient.New(cfg)
+
 		// Create a new MangaDex client
-		client := mangadex.NewClient(cfg, httpClient)
+		client := mangadex.NewClient(cfg, httpClient, config.SessionStore{})
 
-		// Login to MangaDex
-		loginInfo, err := client.Login(ctx)
+		// Login to MangaDex, reusing the saved session when possible
+		err = client.Authenticate(ctx)
 		if err != nil {
 			log.Fatalf("Error logging in to MangaDex: %v", err)
 		}
-		// Set the client to use the login info
-		client.SetAuthToken(loginInfo.AccessToken)
+		// Query the feed from the oldest point still missing chapters
+		since, err := lib.SyncWindowStart(ctx, lastRanAt)
+		if err != nil {
+			log.Fatalf("Error computing the feed window: %v", err)
+		}
 		// Get the list of followed manga
-		mangaList, err := client.GetFollowedMangaFeed(ctx, lastRanAt)
+		mangaList, err := client.GetFollowedMangaFeed(ctx, since)
 		if err != nil {
 			log.Fatalf("Error getting followed manga feed: %v", err)
 		}
 
+		mangaIDs := make([]string, len(mangaList))
+		var chapterIDs []string
+		for i, manga := range mangaList {
+			mangaIDs[i] = manga.Manga.ID
+			for _, chapter := range manga.Chapters {
+				chapterIDs = append(chapterIDs, chapter.Chapter.ID)
+			}
+		}
+
 		// Create a new downloader
-		downloader := downloader.NewDownloader(cfg, httpClient)
+		downloader, err := downloader.NewDownloader(cfg, httpClient, lib)
+		if err != nil {
+			log.Fatalf("Error creating downloader: %v", err)
+		}
 
 		// Download the manga
-		err = downloader.DownloadManga(ctx, mangaList, client)
+		downloadErr := downloader.DownloadManga(ctx, mangaList, client)
+
+		// Outstanding chapters the feed didn't return won't come back, don't let them hold the window back
+		abandoned, err := lib.AbandonMissingChapters(ctx, chapterIDs)
 		if err != nil {
-			log.Fatalf("Error downloading manga: %v", err)
+			log.Fatalf("Error updating outstanding chapters: %v", err)
+		}
+		if abandoned > 0 {
+			log.Printf("Gave up on %v chapters that left the feed before they could be downloaded", abandoned)
 		}
 
-		// Save timestamp for future use
-		err = config.SaveTimestamp()
+		// Save the sync cursors for future use, even if some manga failed so the others aren't held back
+		err = lib.InitMangaCursors(ctx, mangaIDs, since)
+		if err == nil {
+			err = lib.AdvanceMangaCursors(ctx, mangaIDs, syncStartedAt)
+		}
+		if err == nil {
+			err = lib.SetLastSyncedAt(ctx, syncStartedAt)
+		}
 		if err != nil {
-			log.Fatalf("Error writing the timestamp of this run of Godex: %v", err)
+			log.Fatalf("Error writing the sync time of this run of Godex: %v", err)
+		}
+
+		if downloadErr != nil {
+			log.Fatalf("Error downloading manga, failed chapters will be retried on the next run: %v", downloadErr)
 		}
 		log.Println("Downloaded manga successfully")
 	},
 }
 
+func init() {
+	rootCmd.Flags().StringVarP(&imageQuality, "quality", "q", "", "Quality of the downloaded pages, either data or data-saver")
+}
+
+// applyImageQuality overrides the configured image quality with the one passed on the command line.
+func applyImageQuality(cfg *mangadex.Config) {
+	if imageQuality == "" {
+		return
+	}
+	quality, err := mangadex.ParseImageQuality(imageQuality)
+	if err != nil {
+		log.Fatalf("Invalid quality flag: %v", err)
+	}
+	cfg.ImageQuality = quality
+}
+
+// openLibrary opens the library database from the godex data directory.
+func openLibrary() *library.Library {
+	libraryPath, err := config.LibraryPath()
+	if err != nil {
+		log.Fatalf("Error locating the library: %v", err)
+	}
+	lib, err := library.Open(libraryPath)
+	if err != nil {
+		log.Fatalf("Error opening the library: %v", err)
+	}
+	return lib
+}
+
 func Execute() {
 	rootCmd.AddCommand(loadCmd)
 	rootCmd.AddCommand(promptCmd)
 	rootCmd.AddCommand(completeCmd)
+	rootCmd.AddCommand(libraryCmd)
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -0,0 +1,118 @@
+package archive
+
+import (
+	"fmt"
+	"godex/internal/comicinfo"
+	"godex/internal/mangadex"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Writer : Packs the page images of a chapter or volume into a single file.
+type Writer interface {
+	// Extension is the file extension of the archives, dot included.
+	Extension() string
+	// Write archives the pages of pagesDir, in name order, at archivePath and deletes pagesDir.
+	// It returns the number of archived pages.
+	Write(pagesDir string, archivePath string, book *Book) (int, error)
+}
+
+// Book : What an archive holds, for the formats that describe their content.
+type Book struct {
+	// ID uniquely identifies the archive, it is the MangaDex ID of the chapter or manga.
+	ID          string
+	Title       string
+	Series      string
+	Language    string
+	Description string
+	// RightToLeft is true for manga read from right to left.
+	RightToLeft bool
+	// Sections are the chapters of the archive, used as its table of contents.
+	Sections []Section
+	// ComicInfo is the ComicInfo document of the archive.
+	ComicInfo *comicinfo.ComicInfo
+}
+
+// Section : A chapter of an archive, starting at the given page.
+type Section struct {
+	Title     string
+	FirstPage int
+}
+
+// extensions are the extensions of every archive format, longest first so compound extensions match before their suffix.
+var extensions = []string{".kepub.epub", ".epub", ".cbz", ".pdf"}
+
+// mediaTypes maps page image extensions to their media type.
+var mediaTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".avif": "image/avif",
+}
+
+// New returns the writer of an archive format.
+func New(format mangadex.ArchiveFormat) (Writer, error) {
+	switch format {
+	case mangadex.FormatCBZ:
+		return CBZ{}, nil
+	case mangadex.FormatEPUB:
+		return EPUB{}, nil
+	case mangadex.FormatKEPUB:
+		return KEPUB{}, nil
+	case mangadex.FormatPDF:
+		return PDF{}, nil
+	default:
+		return nil, fmt.Errorf("unknown archive format %q", format)
+	}
+}
+
+// Extension returns the extension of the archive format of a file, or an empty string if it isn't an archive.
+func Extension(path string) string {
+	for _, extension := range extensions {
+		if strings.HasSuffix(strings.ToLower(path), extension) {
+			return extension
+		}
+	}
+	return ""
+}
+
+// readPages lists the page images of a directory in name order.
+func readPages(pagesDir string) ([]os.DirEntry, error) {
+	files, err := os.ReadDir(pagesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no pages to archive in %v", pagesDir)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+	return files, nil
+}
+
+// writeFile writes an archive to a temporary file and only renames it to archivePath once complete,
+// so an interrupted run never leaves a partial archive behind.
+func writeFile(archivePath string, write func(io.Writer) error) error {
+	tmpPath := archivePath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	err = write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, archivePath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write %v: %w", archivePath, err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package archive
+
+import (
+	"archive/zip"
+	"fmt"
+	"godex/internal/comicinfo"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// CBZ : Archives pages in a zip, with the ComicInfo document as its first entry.
+type CBZ struct{}
+
+// Extension returns the extension of CBZ files.
+func (CBZ) Extension() string {
+	return ".cbz"
+}
+
+// Write packs the pages in a CBZ file.
+func (CBZ) Write(pagesDir string, archivePath string, book *Book) (int, error) {
+	files, err := readPages(pagesDir)
+	if err != nil {
+		return 0, err
+	}
+	var info []byte
+	if book.ComicInfo != nil {
+		info, err = book.ComicInfo.Marshal()
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = writeFile(archivePath, func(w io.Writer) error {
+		zipWriter := zip.NewWriter(w)
+		if info != nil {
+			if err := addBytesToZip(zipWriter, comicinfo.FileName, info); err != nil {
+				return err
+			}
+		}
+		for _, file := range files {
+			if err := addFileToZip(zipWriter, filepath.Join(pagesDir, file.Name()), file.Name()); err != nil {
+				return err
+			}
+		}
+		return zipWriter.Close()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Delete the pages directory
+	if err := os.RemoveAll(pagesDir); err != nil {
+		return 0, fmt.Errorf("failed to delete directory: %w", err)
+	}
+	return len(files), nil
+}
+
+// addBytesToZip writes a compressed entry with the given content.
+func addBytesToZip(zipWriter *zip.Writer, name string, content []byte) error {
+	writer, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err != nil {
+		return fmt.Errorf("failed to create %v entry: %w", name, err)
+	}
+	if _, err := writer.Write(content); err != nil {
+		return fmt.Errorf("failed to write %v entry: %w", name, err)
+	}
+	return nil
+}
+
+// addFileToZip copies a single file into the zip writer under the given name.
+func addFileToZip(zipWriter *zip.Writer, path string, name string) error {
+	fileToZip, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer fileToZip.Close()
+
+	info, err := fileToZip.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return fmt.Errorf("failed to create zip file header: %w", err)
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("failed to create zip writer header: %w", err)
+	}
+
+	_, err = io.Copy(writer, fileToZip)
+	if err != nil {
+		return fmt.Errorf("failed to copy file to zip: %w", err)
+	}
+	return nil
+}
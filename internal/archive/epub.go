@@ -0,0 +1,363 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultPageWidth and defaultPageHeight size the pages whose image dimensions can't be read.
+const (
+	defaultPageWidth  = 1072
+	defaultPageHeight = 1448
+)
+
+// EPUB : Archives pages in a fixed-layout EPUB3, one page per image.
+type EPUB struct{}
+
+// Extension returns the extension of EPUB files.
+func (EPUB) Extension() string {
+	return ".epub"
+}
+
+// Write packs the pages in a fixed-layout EPUB, with a table of contents listing the sections of the book.
+// The first page is the cover, the pages follow each other in spreads in the reading direction of the book.
+func (EPUB) Write(pagesDir string, archivePath string, book *Book) (int, error) {
+	return writeBook(pagesDir, archivePath, book, false)
+}
+
+// writeBook packs the pages in a fixed-layout EPUB, with the Kobo markup and settings if kobo is true.
+func writeBook(pagesDir string, archivePath string, book *Book, kobo bool) (int, error) {
+	files, err := readPages(pagesDir)
+	if err != nil {
+		return 0, err
+	}
+	pages := make([]epubPage, len(files))
+	for i, file := range files {
+		pages[i], err = newEPUBPage(filepath.Join(pagesDir, file.Name()), i, book.RightToLeft)
+		if err != nil {
+			return 0, err
+		}
+	}
+	content := &epubContent{
+		Book:     book,
+		Language: book.Language,
+		Modified: time.Now().UTC().Format(time.RFC3339),
+		Pages:    pages,
+		Sections: book.Sections,
+		Kobo:     kobo,
+	}
+	if content.Language == "" {
+		content.Language = "en"
+	}
+	if len(content.Sections) == 0 {
+		content.Sections = []Section{{Title: book.Title}}
+	}
+
+	err = writeFile(archivePath, func(w io.Writer) error {
+		return writeEPUB(w, pagesDir, content)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Delete the pages directory
+	if err := os.RemoveAll(pagesDir); err != nil {
+		return 0, fmt.Errorf("failed to delete directory: %w", err)
+	}
+	return len(files), nil
+}
+
+// epubContent : What the EPUB templates are rendered with.
+type epubContent struct {
+	*Book
+	Language string
+	Modified string
+	Pages    []epubPage
+	Sections []Section
+	// Kobo adds the markup and settings Kobo readers need to render pages full screen.
+	Kobo bool
+}
+
+// Resolution returns the size of the largest page, which Kobo readers scale the book from.
+func (c *epubContent) Resolution() string {
+	width, height := 0, 0
+	for _, page := range c.Pages {
+		if page.Width*page.Height > width*height {
+			width, height = page.Width, page.Height
+		}
+	}
+	return fmt.Sprintf("%dx%d", width, height)
+}
+
+// epubPage : A page image along with its size and its place in spreads.
+type epubPage struct {
+	Index     int
+	Image     string
+	MediaType string
+	Width     int
+	Height    int
+	Spread    string
+}
+
+// ID returns the manifest ID of the page document.
+func (p epubPage) ID() string {
+	return fmt.Sprintf("p%04d", p.Index)
+}
+
+// newEPUBPage reads the size of a page image and places it in spreads.
+// The cover stands on its own in the center, the other pages start a spread on the side the book is read from.
+func newEPUBPage(path string, index int, rightToLeft bool) (epubPage, error) {
+	extension := strings.ToLower(filepath.Ext(path))
+	page := epubPage{
+		Index:     index,
+		Image:     fmt.Sprintf("i%04d%s", index, extension),
+		MediaType: mediaTypes[extension],
+		Width:     defaultPageWidth,
+		Height:    defaultPageHeight,
+	}
+	if page.MediaType == "" {
+		return page, fmt.Errorf("unsupported page image %v", path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return page, err
+	}
+	defer file.Close()
+	if config, _, err := image.DecodeConfig(file); err == nil {
+		page.Width, page.Height = config.Width, config.Height
+	}
+
+	first, second := "page-spread-left", "page-spread-right"
+	if rightToLeft {
+		first, second = second, first
+	}
+	switch {
+	case index == 0:
+		page.Spread = "rendition:page-spread-center"
+	case index%2 == 1:
+		page.Spread = first
+	default:
+		page.Spread = second
+	}
+	return page, nil
+}
+
+// writeEPUB writes the EPUB container: the uncompressed mimetype first, then the package documents and the pages.
+func writeEPUB(w io.Writer, pagesDir string, content *epubContent) error {
+	zipWriter := zip.NewWriter(w)
+	if err := addMimetype(zipWriter); err != nil {
+		return err
+	}
+	documents := []struct {
+		name     string
+		template *template.Template
+		data     interface{}
+	}{
+		{"META-INF/container.xml", containerTemplate, content},
+		{"OEBPS/content.opf", packageTemplate, content},
+		{"OEBPS/nav.xhtml", navTemplate, content},
+		{"OEBPS/style.css", styleTemplate, content},
+	}
+	for _, document := range documents {
+		if err := addTemplateToZip(zipWriter, document.name, document.template, document.data); err != nil {
+			return err
+		}
+	}
+	files, err := readPages(pagesDir)
+	if err != nil {
+		return err
+	}
+	for i, page := range content.Pages {
+		pageData := struct {
+			*epubContent
+			Page epubPage
+		}{content, page}
+		if err := addTemplateToZip(zipWriter, "OEBPS/pages/"+page.ID()+".xhtml", pageTemplate, pageData); err != nil {
+			return err
+		}
+		if err := addFileToZip(zipWriter, filepath.Join(pagesDir, files[i].Name()), "OEBPS/images/"+page.Image); err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
+
+// addMimetype writes the mimetype entry the way readers expect it: stored, without extra field or data descriptor.
+func addMimetype(zipWriter *zip.Writer) error {
+	content := []byte("application/epub+zip")
+	writer, err := zipWriter.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(content),
+		CompressedSize64:   uint64(len(content)),
+		UncompressedSize64: uint64(len(content)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create mimetype entry: %w", err)
+	}
+	_, err = writer.Write(content)
+	return err
+}
+
+// addTemplateToZip renders a template into a new entry.
+func addTemplateToZip(zipWriter *zip.Writer, name string, tmpl *template.Template, data interface{}) error {
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return fmt.Errorf("failed to render %v: %w", name, err)
+	}
+	return addBytesToZip(zipWriter, name, b.Bytes())
+}
+
+// escape escapes text for XML documents.
+func escape(text string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// pageID returns the manifest ID of the page document of the given page index.
+func pageID(index int) string {
+	return epubPage{Index: index}.ID()
+}
+
+func parseTemplate(name string, text string) *template.Template {
+	return template.Must(template.New(name).Funcs(template.FuncMap{
+		"escape": escape,
+		"pageID": pageID,
+	}).Parse(text))
+}
+
+var containerTemplate = parseTemplate("container", `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`)
+
+var packageTemplate = parseTemplate("package", `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="{{escape .Language}}" prefix="rendition: http://www.idpf.org/vocab/rendition/#">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">{{escape .ID}}</dc:identifier>
+    <dc:title>{{escape .Title}}</dc:title>
+    <dc:language>{{escape .Language}}</dc:language>
+{{- if .Description}}
+    <dc:description>{{escape .Description}}</dc:description>
+{{- end}}
+{{- if .Series}}
+    <meta property="belongs-to-collection" id="series">{{escape .Series}}</meta>
+    <meta refines="#series" property="collection-type">series</meta>
+{{- end}}
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+    <meta property="rendition:layout">pre-paginated</meta>
+    <meta property="rendition:orientation">auto</meta>
+{{- if .Kobo}}
+    <meta property="rendition:spread">none</meta>
+    <meta name="original-resolution" content="{{.Resolution}}"/>
+{{- if .RightToLeft}}
+    <meta name="primary-writing-mode" content="horizontal-rl"/>
+{{- end}}
+{{- else}}
+    <meta property="rendition:spread">landscape</meta>
+{{- end}}
+    <meta name="cover" content="cover"/>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="style" href="style.css" media-type="text/css"/>
+{{- range .Pages}}
+    <item id="{{.ID}}" href="pages/{{.ID}}.xhtml" media-type="application/xhtml+xml"/>
+    <item id="{{if eq .Index 0}}cover{{else}}{{.ID}}-image{{end}}" href="images/{{.Image}}" media-type="{{.MediaType}}"{{if eq .Index 0}} properties="cover-image"{{end}}/>
+{{- end}}
+  </manifest>
+  <spine page-progression-direction="{{if .RightToLeft}}rtl{{else}}ltr{{end}}">
+{{- range .Pages}}
+    <itemref idref="{{.ID}}" properties="{{.Spread}}"/>
+{{- end}}
+  </spine>
+</package>
+`)
+
+var navTemplate = parseTemplate("nav", `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{escape .Language}}">
+<head>
+  <title>{{escape .Title}}</title>
+</head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <h1>{{escape .Title}}</h1>
+    <ol>
+{{- range .Sections}}
+      <li><a href="pages/{{pageID .FirstPage}}.xhtml">{{escape .Title}}</a></li>
+{{- end}}
+    </ol>
+  </nav>
+  <nav epub:type="landmarks" id="landmarks" hidden="">
+    <ol>
+      <li><a epub:type="cover" href="pages/{{pageID 0}}.xhtml">Cover</a></li>
+      <li><a epub:type="bodymatter" href="pages/{{pageID 0}}.xhtml">Start</a></li>
+    </ol>
+  </nav>
+</body>
+</html>
+`)
+
+var styleTemplate = parseTemplate("style", `html, body {
+  margin: 0;
+  padding: 0;
+}
+img {
+  position: absolute;
+  top: 0;
+  left: 0;
+  margin: 0;
+  padding: 0;
+}
+{{- if .Kobo}}
+@page {
+  margin: 0;
+}
+#book-columns, #book-inner {
+  margin: 0;
+  padding: 0;
+  width: 100%;
+  height: 100%;
+}
+{{- end}}
+`)
+
+var pageTemplate = parseTemplate("page", `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{escape .Language}}">
+<head>
+  <title>{{escape .Title}}</title>
+  <link href="../style.css" rel="stylesheet" type="text/css"/>
+  <meta name="viewport" content="width={{.Page.Width}}, height={{.Page.Height}}"/>
+</head>
+<body style="width: {{.Page.Width}}px; height: {{.Page.Height}}px;">
+{{- if .Kobo}}
+  <div id="book-columns">
+    <div id="book-inner">
+      <span class="koboSpan" id="kobo.1.1"><img src="../images/{{.Page.Image}}" alt="{{.Page.Index}}" width="{{.Page.Width}}" height="{{.Page.Height}}"/></span>
+    </div>
+  </div>
+{{- else}}
+  <img src="../images/{{.Page.Image}}" alt="{{.Page.Index}}" width="{{.Page.Width}}" height="{{.Page.Height}}"/>
+{{- end}}
+</body>
+</html>
+`)
@@ -0,0 +1,216 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ExtractPages copies the page images of an archive into a directory, numbering them from firstPage on.
+// Images are taken in name order, whatever folder of the archive they are in.
+// Pages are numbered on four digits so volumes of more than a thousand pages still sort in reading order.
+// It returns the number of extracted pages.
+func ExtractPages(archivePath string, dir string, firstPage int) (int, error) {
+	if Extension(archivePath) == ".pdf" {
+		return extractPDFPages(archivePath, dir, firstPage)
+	}
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %v: %w", archivePath, err)
+	}
+	defer reader.Close()
+
+	files := make([]*zip.File, 0, len(reader.File))
+	for _, file := range reader.File {
+		if _, ok := mediaTypes[strings.ToLower(path.Ext(file.Name))]; ok && !file.FileInfo().IsDir() {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+
+	for i, file := range files {
+		name := fmt.Sprintf("%04d%s", firstPage+i, path.Ext(file.Name))
+		if err := extractFile(file, filepath.Join(dir, name)); err != nil {
+			return 0, fmt.Errorf("failed to extract %v from %v: %w", file.Name, archivePath, err)
+		}
+	}
+	return len(files), nil
+}
+
+// extractFile writes a single zip entry to target.
+func extractFile(file *zip.File, target string) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, reader); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// pdfImagePattern matches the start of the image objects of the PDF documents godex writes, up to their stream data.
+var pdfImagePattern = regexp.MustCompile(`(\d+) 0 obj\n<< /Type /XObject /Subtype /Image ([^>]*)>>\nstream\n`)
+
+// pdfObject : An image object read back from a PDF document.
+type pdfObject struct {
+	number int
+	dict   string
+	data   []byte
+}
+
+// extractPDFPages copies the page images of a PDF document written by godex into a directory, numbering them from firstPage on.
+// JPEG images are copied as they are, the other images are saved as PNG along with their alpha channel.
+// It returns the number of extracted pages.
+func extractPDFPages(archivePath string, dir string, firstPage int) (int, error) {
+	content, err := os.ReadFile(archivePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %v: %w", archivePath, err)
+	}
+
+	// Images are written in page order, each one followed by the next object once its stream ends
+	objects := make(map[int]*pdfObject)
+	var images []*pdfObject
+	masks := make(map[int]bool)
+	for offset := 0; ; {
+		match := pdfImagePattern.FindSubmatchIndex(content[offset:])
+		if match == nil {
+			break
+		}
+		number, _ := strconv.Atoi(string(content[offset+match[2] : offset+match[3]]))
+		dict := string(content[offset+match[4] : offset+match[5]])
+		start := offset + match[1]
+		length := pdfInt(dict, "Length")
+		if length < 0 || start+length > len(content) {
+			return 0, fmt.Errorf("failed to read image %v of %v: invalid length", number, archivePath)
+		}
+		object := &pdfObject{number: number, dict: dict, data: content[start : start+length]}
+		objects[number] = object
+		images = append(images, object)
+		if mask := pdfInt(dict, "SMask"); mask > 0 {
+			masks[mask] = true
+		}
+		offset = start + length
+	}
+
+	pages := 0
+	for _, object := range images {
+		if masks[object.number] {
+			continue
+		}
+		name := filepath.Join(dir, fmt.Sprintf("%04d", firstPage+pages))
+		if strings.Contains(object.dict, "/DCTDecode") {
+			err = os.WriteFile(name+".jpg", object.data, 0644)
+		} else {
+			err = writeFlateImage(name+".png", object, objects[pdfInt(object.dict, "SMask")])
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to extract image %v from %v: %w", object.number, archivePath, err)
+		}
+		pages++
+	}
+	return pages, nil
+}
+
+// writeFlateImage saves the Flate compressed samples of an image, and of its alpha channel if it has one, as a PNG.
+func writeFlateImage(target string, object *pdfObject, mask *pdfObject) error {
+	width, height := pdfInt(object.dict, "Width"), pdfInt(object.dict, "Height")
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid image size %vx%v", width, height)
+	}
+	channels := 3
+	if strings.Contains(object.dict, "/DeviceGray") {
+		channels = 1
+	}
+	samples, err := inflate(object.data, width*height*channels)
+	if err != nil {
+		return err
+	}
+	var alpha []byte
+	if mask != nil {
+		if alpha, err = inflate(mask.data, width*height); err != nil {
+			return err
+		}
+	}
+
+	var img image.Image
+	if channels == 1 && alpha == nil {
+		img = &image.Gray{Pix: samples, Stride: width, Rect: image.Rect(0, 0, width, height)}
+	} else {
+		nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+		for i := 0; i < width*height; i++ {
+			pixel := nrgba.Pix[i*4 : i*4+4]
+			if channels == 1 {
+				pixel[0], pixel[1], pixel[2] = samples[i], samples[i], samples[i]
+			} else {
+				pixel[0], pixel[1], pixel[2] = samples[i*3], samples[i*3+1], samples[i*3+2]
+			}
+			pixel[3] = 0xff
+			if alpha != nil {
+				pixel[3] = alpha[i]
+			}
+		}
+		img = nrgba
+	}
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(out, img); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// inflate decompresses a Flate stream holding the given number of bytes.
+func inflate(data []byte, size int) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	samples := make([]byte, size)
+	if _, err := io.ReadFull(reader, samples); err != nil {
+		return nil, fmt.Errorf("failed to decompress image: %w", err)
+	}
+	return samples, nil
+}
+
+// pdfInt returns the integer value of a dictionary entry, the object number for references, or -1 if it is missing.
+func pdfInt(dict string, key string) int {
+	_, value, found := strings.Cut(dict, "/"+key+" ")
+	if !found {
+		return -1
+	}
+	end := strings.IndexFunc(value, func(r rune) bool { return r < '0' || r > '9' })
+	if end == -1 {
+		end = len(value)
+	}
+	number, err := strconv.Atoi(value[:end])
+	if err != nil {
+		return -1
+	}
+	return number
+}
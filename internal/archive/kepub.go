@@ -0,0 +1,17 @@
+package archive
+
+// KEPUB : Archives pages in a fixed-layout EPUB3 with the markup of Kobo's own EPUB flavor,
+// so Kobo readers open it with their native renderer and show pages edge to edge.
+type KEPUB struct{}
+
+// Extension returns the extension of KEPUB files, which Kobo readers require to pick their native renderer.
+func (KEPUB) Extension() string {
+	return ".kepub.epub"
+}
+
+// Write packs the pages in a fixed-layout EPUB, each page image wrapped in a Kobo span inside the book columns Kobo lays pages out in.
+// Spreads are turned off and the size of the largest page is given as the original resolution,
+// so every page is scaled to fill the screen on its own.
+func (KEPUB) Write(pagesDir string, archivePath string, book *Book) (int, error) {
+	return writeBook(pagesDir, archivePath, book, true)
+}
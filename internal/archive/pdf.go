@@ -0,0 +1,371 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	_ "golang.org/x/image/webp"
+)
+
+// PDF : Archives pages in a PDF document, one page per image at the native size of the image.
+type PDF struct{}
+
+// Extension returns the extension of PDF files.
+func (PDF) Extension() string {
+	return ".pdf"
+}
+
+// Write packs the pages in a PDF document. JPEG images are embedded as they are, the other images are stored losslessly as Flate streams.
+// The sections of the book make up the document outline, and its metadata fills the document information dictionary.
+func (PDF) Write(pagesDir string, archivePath string, book *Book) (int, error) {
+	files, err := readPages(pagesDir)
+	if err != nil {
+		return 0, err
+	}
+	err = writeFile(archivePath, func(w io.Writer) error {
+		paths := make([]string, len(files))
+		for i, file := range files {
+			paths[i] = filepath.Join(pagesDir, file.Name())
+		}
+		return writePDF(w, paths, book)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Delete the pages directory
+	if err := os.RemoveAll(pagesDir); err != nil {
+		return 0, fmt.Errorf("failed to delete directory: %w", err)
+	}
+	return len(files), nil
+}
+
+// pdfWriter : Writes the objects of a PDF document and keeps track of their offsets for the cross-reference table.
+type pdfWriter struct {
+	w      *bufio.Writer
+	offset int
+	// offsets holds the offset of every object, object n being at index n-1.
+	offsets []int
+}
+
+// write writes formatted content. Errors are kept by the buffered writer and returned when it is flushed.
+func (p *pdfWriter) write(format string, args ...interface{}) {
+	n, _ := fmt.Fprintf(p.w, format, args...)
+	p.offset += n
+}
+
+// writeBytes writes raw content.
+func (p *pdfWriter) writeBytes(content []byte) {
+	n, _ := p.w.Write(content)
+	p.offset += n
+}
+
+// newObject reserves the number of an object, so it can be referenced before it is written.
+func (p *pdfWriter) newObject() int {
+	p.offsets = append(p.offsets, 0)
+	return len(p.offsets)
+}
+
+// writeObject writes an object whose content is a dictionary or an array.
+func (p *pdfWriter) writeObject(number int, format string, args ...interface{}) {
+	p.offsets[number-1] = p.offset
+	p.write("%d 0 obj\n", number)
+	p.write(format, args...)
+	p.write("\nendobj\n")
+}
+
+// writeStream writes a stream object, dict holding the entries of its dictionary other than its length.
+func (p *pdfWriter) writeStream(number int, dict string, data []byte) {
+	p.offsets[number-1] = p.offset
+	if dict != "" {
+		dict += " "
+	}
+	p.write("%d 0 obj\n<< %s/Length %d >>\nstream\n", number, dict, len(data))
+	p.writeBytes(data)
+	p.write("\nendstream\nendobj\n")
+}
+
+// writePDF writes a PDF document showing every page image on its own page.
+// Pages are written as they are read so only one image is held in memory at a time.
+func writePDF(w io.Writer, paths []string, book *Book) error {
+	p := &pdfWriter{w: bufio.NewWriter(w)}
+	p.writeBytes([]byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"))
+	catalog := p.newObject()
+	pages := p.newObject()
+	info := p.newObject()
+
+	pageRefs := make([]int, len(paths))
+	for i, path := range paths {
+		img, err := newPDFImage(path)
+		if err != nil {
+			return err
+		}
+		imageRef := p.newObject()
+		imageDict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d %s", img.width, img.height, img.dict)
+		if img.mask != nil {
+			maskRef := p.newObject()
+			p.writeStream(maskRef, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode", img.width, img.height), img.mask)
+			imageDict += fmt.Sprintf(" /SMask %d 0 R", maskRef)
+		}
+		p.writeStream(imageRef, imageDict, img.data)
+
+		contentRef := p.newObject()
+		p.writeStream(contentRef, "", []byte(fmt.Sprintf("q %d 0 0 %d 0 0 cm /Im0 Do Q", img.width, img.height)))
+		pageRefs[i] = p.newObject()
+		p.writeObject(pageRefs[i], "<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+			pages, img.width, img.height, imageRef, contentRef)
+	}
+
+	kids := make([]string, len(pageRefs))
+	for i, ref := range pageRefs {
+		kids[i] = fmt.Sprintf("%d 0 R", ref)
+	}
+	p.writeObject(pages, "<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pageRefs))
+	p.writeObject(info, "<< %s >>", pdfInfo(book))
+
+	catalogDict := fmt.Sprintf("/Type /Catalog /Pages %d 0 R", pages)
+	if book.Language != "" {
+		catalogDict += " /Lang " + pdfString(book.Language)
+	}
+	if outlines := p.writeOutline(book.Sections, pageRefs); outlines != 0 {
+		catalogDict += fmt.Sprintf(" /Outlines %d 0 R /PageMode /UseOutlines", outlines)
+	}
+	if book.RightToLeft {
+		catalogDict += " /ViewerPreferences << /Direction /R2L >>"
+	}
+	p.writeObject(catalog, "<< %s >>", catalogDict)
+
+	xref := p.offset
+	p.write("xref\n0 %d\n0000000000 65535 f \n", len(p.offsets)+1)
+	for _, offset := range p.offsets {
+		p.write("%010d 00000 n \n", offset)
+	}
+	p.write("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%EOF\n", len(p.offsets)+1, catalog, info, xref)
+	if err := p.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write PDF: %w", err)
+	}
+	return nil
+}
+
+// writeOutline writes the document outline, one entry per section pointing to its first page.
+// It returns the number of the outline object, or 0 if the book has no sections.
+func (p *pdfWriter) writeOutline(sections []Section, pageRefs []int) int {
+	entries := make([]Section, 0, len(sections))
+	for _, section := range sections {
+		if section.FirstPage >= 0 && section.FirstPage < len(pageRefs) {
+			entries = append(entries, section)
+		}
+	}
+	if len(entries) == 0 {
+		return 0
+	}
+	outlines := p.newObject()
+	refs := make([]int, len(entries))
+	for i := range entries {
+		refs[i] = p.newObject()
+	}
+	for i, entry := range entries {
+		links := ""
+		if i > 0 {
+			links += fmt.Sprintf(" /Prev %d 0 R", refs[i-1])
+		}
+		if i < len(entries)-1 {
+			links += fmt.Sprintf(" /Next %d 0 R", refs[i+1])
+		}
+		p.writeObject(refs[i], "<< /Title %s /Parent %d 0 R%s /Dest [%d 0 R /Fit] >>", pdfString(entry.Title), outlines, links, pageRefs[entry.FirstPage])
+	}
+	p.writeObject(outlines, "<< /Type /Outlines /First %d 0 R /Last %d 0 R /Count %d >>", refs[0], refs[len(refs)-1], len(refs))
+	return outlines
+}
+
+// pdfInfo returns the entries of the document information dictionary of a book.
+// The alternative titles and age rating of the manga are given as keywords.
+func pdfInfo(book *Book) string {
+	now := time.Now().UTC().Format("D:20060102150405Z")
+	entries := []string{"/Title " + pdfString(book.Title)}
+	if book.Description != "" {
+		entries = append(entries, "/Subject "+pdfString(book.Description))
+	}
+	if info := book.ComicInfo; info != nil {
+		var keywords []string
+		if info.AlternateSeries != "" {
+			keywords = append(keywords, info.AlternateSeries)
+		}
+		if info.AgeRating != "" {
+			keywords = append(keywords, info.AgeRating)
+		}
+		if len(keywords) > 0 {
+			entries = append(entries, "/Keywords "+pdfString(strings.Join(keywords, ", ")))
+		}
+	}
+	entries = append(entries, "/Creator (godex)", "/Producer (godex)", "/CreationDate ("+now+")", "/ModDate ("+now+")")
+	return strings.Join(entries, " ")
+}
+
+// pdfString encodes text as a PDF string, in UTF-16 when it isn't plain ASCII.
+func pdfString(text string) string {
+	ascii := true
+	for _, r := range text {
+		if r < 0x20 || r >= 0x7f {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return "(" + strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(text) + ")"
+	}
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, unit := range utf16.Encode([]rune(text)) {
+		fmt.Fprintf(&b, "%04X", unit)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// pdfImage : A page image as embedded in a PDF document.
+type pdfImage struct {
+	width  int
+	height int
+	// dict holds the entries of the image dictionary describing its data.
+	dict string
+	data []byte
+	// mask is the Flate compressed alpha channel of the image, nil for opaque images.
+	mask []byte
+}
+
+// newPDFImage reads a page image. JPEG images are kept as they are since PDF readers decode them natively,
+// the other images are decoded and their samples stored as Flate streams.
+func newPDFImage(path string) (*pdfImage, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read page image: %w", err)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported page image %v: %w", path, err)
+	}
+	if format == "jpeg" {
+		return &pdfImage{
+			width:  config.Width,
+			height: config.Height,
+			dict:   fmt.Sprintf("/ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode", jpegColorSpace(config.ColorModel)),
+			data:   content,
+		}, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode page image %v: %w", path, err)
+	}
+	return flateImage(img)
+}
+
+// jpegColorSpace returns the color space of a JPEG image.
+// CMYK JPEG images are written inverted by the Adobe applications that make them, so their samples are decoded inverted.
+func jpegColorSpace(model color.Model) string {
+	switch model {
+	case color.GrayModel:
+		return "/DeviceGray"
+	case color.CMYKModel:
+		return "/DeviceCMYK /Decode [1 0 1 0 1 0 1 0]"
+	default:
+		return "/DeviceRGB"
+	}
+}
+
+// flateImage stores the samples of an image as Flate streams, in gray levels when the image only has grays.
+func flateImage(img image.Image) (*pdfImage, error) {
+	bounds := img.Bounds()
+	gray := isGray(img)
+	opaque := false
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		opaque = o.Opaque()
+	}
+
+	channels := 3
+	colorSpace := "/DeviceRGB"
+	if gray {
+		channels = 1
+		colorSpace = "/DeviceGray"
+	}
+	samples := make([]byte, 0, bounds.Dx()*bounds.Dy()*channels)
+	var alpha []byte
+	if !opaque {
+		alpha = make([]byte, 0, bounds.Dx()*bounds.Dy())
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if gray {
+				samples = append(samples, c.R)
+			} else {
+				samples = append(samples, c.R, c.G, c.B)
+			}
+			if !opaque {
+				alpha = append(alpha, c.A)
+			}
+		}
+	}
+
+	data, err := deflate(samples)
+	if err != nil {
+		return nil, err
+	}
+	pdfImg := &pdfImage{
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+		dict:   fmt.Sprintf("/ColorSpace %s /BitsPerComponent 8 /Filter /FlateDecode", colorSpace),
+		data:   data,
+	}
+	if alpha != nil {
+		pdfImg.mask, err = deflate(alpha)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pdfImg, nil
+}
+
+// isGray tells if an image only has gray levels, which is the case of most scans.
+func isGray(img image.Image) bool {
+	switch img := img.(type) {
+	case *image.Gray, *image.Gray16:
+		return true
+	case *image.Paletted:
+		for _, c := range img.Palette {
+			r, g, b, _ := c.RGBA()
+			if r != g || g != b {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// deflate compresses data in the zlib format Flate streams use.
+func deflate(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	writer := zlib.NewWriter(&b)
+	if _, err := writer.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress image: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress image: %w", err)
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,287 @@
+package comicinfo
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"godex/internal/mangadex"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FileName is the name ComicInfo documents must have inside an archive.
+const FileName = "ComicInfo.xml"
+
+const (
+	chapterUrl = "https://mangadex.org/chapter/%v"
+	mangaUrl   = "https://mangadex.org/title/%v"
+)
+
+// ComicInfo : A ComicInfo v2.0 document as read by Komga, Kavita, KOReader and Kobo.
+// See https://github.com/anansi-project/comicinfo/blob/main/schema/v2.0/ComicInfo.xsd
+type ComicInfo struct {
+	XMLName         xml.Name `xml:"ComicInfo"`
+	XMLNSXsi        string   `xml:"xmlns:xsi,attr"`
+	XMLNSXsd        string   `xml:"xmlns:xsd,attr"`
+	Title           string   `xml:"Title,omitempty"`
+	Series          string   `xml:"Series,omitempty"`
+	Number          string   `xml:"Number,omitempty"`
+	Count           int      `xml:"Count,omitempty"`
+	Volume          int      `xml:"Volume,omitempty"`
+	AlternateSeries string   `xml:"AlternateSeries,omitempty"`
+	Summary         string   `xml:"Summary,omitempty"`
+	Notes           string   `xml:"Notes,omitempty"`
+	Year            int      `xml:"Year,omitempty"`
+	Web             string   `xml:"Web,omitempty"`
+	PageCount       int      `xml:"PageCount"`
+	LanguageISO     string   `xml:"LanguageISO,omitempty"`
+	Manga           string   `xml:"Manga,omitempty"`
+	ScanInformation string   `xml:"ScanInformation,omitempty"`
+	AgeRating       string   `xml:"AgeRating,omitempty"`
+	Pages           []Page   `xml:"Pages>Page"`
+}
+
+// Page : The description of a single page image of the archive.
+type Page struct {
+	Image       int    `xml:"Image,attr"`
+	Type        string `xml:"Type,attr,omitempty"`
+	ImageSize   int64  `xml:"ImageSize,attr,omitempty"`
+	ImageWidth  int    `xml:"ImageWidth,attr,omitempty"`
+	ImageHeight int    `xml:"ImageHeight,attr,omitempty"`
+}
+
+// ageRatings maps MangaDex content ratings to ComicInfo age ratings.
+var ageRatings = map[string]string{
+	"safe":         "Everyone",
+	"suggestive":   "Teen",
+	"erotica":      "Mature 17+",
+	"pornographic": "Adults Only 18+",
+}
+
+// New builds the ComicInfo document of a chapter out of its MangaDex metadata and the page images in chapterDir.
+// The series title and summary are picked in the first available of the preferred languages.
+// Pages are listed in the order they are archived in.
+func New(manga *mangadex.Manga, chapter *mangadex.Chapter, languages []string, chapterDir string) (*ComicInfo, error) {
+	info, err := newSeries(manga, languages, chapterDir)
+	if err != nil {
+		return nil, err
+	}
+	chapterAttributes := chapter.Attributes
+	info.Title = chapterAttributes.Title
+	info.Web = fmt.Sprintf(chapterUrl, chapter.ID)
+	info.LanguageISO = chapterAttributes.TranslatedLanguage
+	if chapterAttributes.Chapter != nil {
+		info.Number = *chapterAttributes.Chapter
+	}
+	if chapterAttributes.Volume != nil {
+		info.Volume, _ = strconv.Atoi(*chapterAttributes.Volume)
+	}
+	info.ScanInformation = strings.Join(groupNames(chapter), ", ")
+	return info, nil
+}
+
+// NewVolume builds the ComicInfo document of a volume packing the given chapters, whose pages are in volumeDir.
+func NewVolume(manga *mangadex.Manga, volume string, chapters []*mangadex.Chapter, languages []string, volumeDir string) (*ComicInfo, error) {
+	info, err := newSeries(manga, languages, volumeDir)
+	if err != nil {
+		return nil, err
+	}
+	info.Title = "Volume " + volume
+	info.Volume, _ = strconv.Atoi(volume)
+	info.Web = fmt.Sprintf(mangaUrl, manga.ID)
+	seen := make(map[string]bool)
+	groups := make([]string, 0)
+	for _, chapter := range chapters {
+		if info.LanguageISO == "" {
+			info.LanguageISO = chapter.Attributes.TranslatedLanguage
+		}
+		for _, name := range groupNames(chapter) {
+			if !seen[name] {
+				seen[name] = true
+				groups = append(groups, name)
+			}
+		}
+	}
+	info.ScanInformation = strings.Join(groups, ", ")
+	return info, nil
+}
+
+// newSeries fills the parts of a document coming from the manga and the page images in dir.
+func newSeries(manga *mangadex.Manga, languages []string, dir string) (*ComicInfo, error) {
+	pages, err := readPages(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	mangaAttributes := manga.Attributes
+	info := &ComicInfo{
+		XMLNSXsi:  "http://www.w3.org/2001/XMLSchema-instance",
+		XMLNSXsd:  "http://www.w3.org/2001/XMLSchema",
+		Series:    manga.Title(languages),
+		Summary:   mangaAttributes.Description.Preferred(languages),
+		PageCount: len(pages),
+		Manga:     readingDirection(manga),
+		Pages:     pages,
+	}
+	if mangaAttributes.Year != nil {
+		info.Year = *mangaAttributes.Year
+	}
+	if mangaAttributes.Status != nil {
+		info.Notes = "Publication status: " + *mangaAttributes.Status
+		if *mangaAttributes.Status == "completed" && mangaAttributes.LastChapter != nil {
+			info.Count, _ = strconv.Atoi(*mangaAttributes.LastChapter)
+		}
+	}
+	if mangaAttributes.ContentRating != nil {
+		info.AgeRating = ageRatings[*mangaAttributes.ContentRating]
+	}
+	info.AlternateSeries = strings.Join(altTitles(mangaAttributes, info.Series), "; ")
+	return info, nil
+}
+
+// groupNames lists the names of the scanlation groups of a chapter.
+func groupNames(chapter *mangadex.Chapter) []string {
+	names := make([]string, 0)
+	for _, group := range chapter.Groups() {
+		names = append(names, group.Label())
+	}
+	return names
+}
+
+// Marshal encodes the document with its XML header.
+func (c *ComicInfo) Marshal() ([]byte, error) {
+	content, err := xml.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling ComicInfo: %w", err)
+	}
+	return append([]byte(xml.Header), content...), nil
+}
+
+// ReadArchive reads the ComicInfo document embedded in an archive.
+// It returns nil if the archive doesn't have one.
+func ReadArchive(archivePath string) (*ComicInfo, error) {
+	archive, err := zip.OpenReader(archivePath)
+	if errors.Is(err, zip.ErrFormat) {
+		// Archives that aren't zip files, such as PDF documents, have no ComicInfo document
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening %v: %w", archivePath, err)
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if file.Name != FileName {
+			continue
+		}
+		content, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("error reading ComicInfo of %v: %w", archivePath, err)
+		}
+		defer content.Close()
+		info := &ComicInfo{}
+		if err := xml.NewDecoder(content).Decode(info); err != nil {
+			return nil, fmt.Errorf("error decoding ComicInfo of %v: %w", archivePath, err)
+		}
+		return info, nil
+	}
+	return nil, nil
+}
+
+// ChapterID returns the MangaDex ID of the chapter the document describes, taken from its web link.
+// It returns an empty string if the link isn't a MangaDex chapter link.
+func (c *ComicInfo) ChapterID() string {
+	prefix := strings.TrimSuffix(chapterUrl, "%v")
+	id, found := strings.CutPrefix(c.Web, prefix)
+	if !found {
+		return ""
+	}
+	return strings.Trim(id, "/")
+}
+
+// RightToLeft tells if the document describes a manga read from right to left.
+func (c *ComicInfo) RightToLeft() bool {
+	return c.Manga == "YesAndRightToLeft"
+}
+
+// readPages reads the size and dimensions of every image in the chapter directory, sorted by name.
+// The first page is marked as the cover.
+func readPages(chapterDir string) ([]Page, error) {
+	files, err := os.ReadDir(chapterDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+
+	pages := make([]Page, 0, len(files))
+	for i, file := range files {
+		page, err := readPage(filepath.Join(chapterDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		page.Image = i
+		if i == 0 {
+			page.Type = "FrontCover"
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// readPage decodes the header of a page image to get its dimensions.
+func readPage(path string) (Page, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Page{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return Page{}, err
+	}
+	page := Page{ImageSize: info.Size()}
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		// Unknown formats are still archived, only without their dimensions
+		return page, nil
+	}
+	page.ImageWidth = config.Width
+	page.ImageHeight = config.Height
+	return page, nil
+}
+
+// readingDirection tells readers whether the series is a manga read from right to left.
+func readingDirection(manga *mangadex.Manga) string {
+	if manga.RightToLeft() {
+		return "YesAndRightToLeft"
+	}
+	return "Yes"
+}
+
+// altTitles lists the alternative titles of a manga, without the one used as the series title.
+func altTitles(attributes mangadex.MangaAttributes, series string) []string {
+	languages := make([]string, 0, len(attributes.AltTitles.Values))
+	for language := range attributes.AltTitles.Values {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+
+	titles := make([]string, 0, len(languages))
+	for _, language := range languages {
+		if title := attributes.AltTitles.Values[language]; title != series {
+			titles = append(titles, title)
+		}
+	}
+	return titles
+}
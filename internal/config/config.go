@@ -1,7 +1,10 @@
 package config
 
 import (
+	"fmt"
+	"godex/internal/imaging"
 	"godex/internal/mangadex"
+	"godex/internal/naming"
 	"godex/internal/util"
 	"log"
 	"os"
@@ -10,6 +13,41 @@ import (
 	"github.com/spf13/viper"
 )
 
+const (
+	defaultRateLimit       = 5
+	defaultAtHomeRateLimit = 40
+	defaultMaxRetries      = 3
+	defaultImageQuality    = mangadex.QualityData
+	defaultPageValidation  = mangadex.ValidateHeader
+
+	defaultFilenameReplacement   = "_"
+	defaultFilenameMaxLength     = 200
+	defaultFilenameNormalization = "NFC"
+
+	defaultDuplicateChapters = mangadex.DuplicateKeepFirst
+	defaultPackaging         = mangadex.PackageChapters
+	defaultFormat            = mangadex.FormatCBZ
+)
+
+var defaultLanguages = []string{"en"}
+
+const (
+	libraryFile       = "library.db"
+	renameJournalFile = "rename-journal.jsonl"
+)
+
+// LibraryPath returns the path of the library database in the godex data directory.
+func LibraryPath() (string, error) {
+	scope := gap.NewScope(gap.User, "godex")
+	return scope.DataPath(libraryFile)
+}
+
+// RenameJournalPath returns the path of the journal of the last library rename, used to roll it back.
+func RenameJournalPath() (string, error) {
+	scope := gap.NewScope(gap.User, "godex")
+	return scope.DataPath(renameJournalFile)
+}
+
 func ConfigExists() (bool, error) {
 	scope := gap.NewScope(gap.User, "godex")
 	configPath, err := scope.ConfigPath("config.json")
@@ -27,6 +65,24 @@ func LoadConfig() (*mangadex.Config, error) {
 		return nil, err
 	}
 	viper.SetConfigFile(configFile)
+	viper.SetDefault("RateLimit", defaultRateLimit)
+	viper.SetDefault("AtHomeRateLimit", defaultAtHomeRateLimit)
+	viper.SetDefault("MaxRetries", defaultMaxRetries)
+	viper.SetDefault("ImageQuality", string(defaultImageQuality))
+	viper.SetDefault("PageValidation", string(defaultPageValidation))
+	viper.SetDefault("Languages", defaultLanguages)
+	viper.SetDefault("Filenames.Replacement", defaultFilenameReplacement)
+	viper.SetDefault("Filenames.MaxLength", defaultFilenameMaxLength)
+	viper.SetDefault("Filenames.Normalization", defaultFilenameNormalization)
+	viper.SetDefault("Filenames.Template", naming.DefaultTemplate)
+	viper.SetDefault("Filenames.VolumeTemplate", naming.DefaultVolumeTemplate)
+	viper.SetDefault("Packaging", string(defaultPackaging))
+	viper.SetDefault("Format", string(defaultFormat))
+	viper.SetDefault("DuplicateChapters", string(defaultDuplicateChapters))
+	viper.SetDefault("Processing.Quality", imaging.DefaultQuality)
+	viper.SetDefault("Processing.Crop.Tolerance", imaging.DefaultCropTolerance)
+	viper.SetDefault("Processing.Crop.Threshold", imaging.DefaultCropThreshold)
+	viper.SetDefault("Processing.Crop.MaxPercent", imaging.DefaultCropMaxPercent)
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, err
@@ -36,6 +92,47 @@ func LoadConfig() (*mangadex.Config, error) {
 	if err := viper.Unmarshal(env); err != nil {
 		return nil, err
 	}
+	if _, err := mangadex.ParseImageQuality(string(env.ImageQuality)); err != nil {
+		return nil, err
+	}
+	if _, err := mangadex.ParsePageValidation(string(env.PageValidation)); err != nil {
+		return nil, err
+	}
+	if _, err := mangadex.ParseDuplicatePolicy(string(env.DuplicateChapters)); err != nil {
+		return nil, err
+	}
+	if _, err := naming.Parse(env.Filenames.Template); err != nil {
+		return nil, err
+	}
+	if _, err := naming.Parse(env.Filenames.VolumeTemplate); err != nil {
+		return nil, err
+	}
+	if _, err := mangadex.ParsePackaging(string(env.Packaging)); err != nil {
+		return nil, err
+	}
+	if _, err := mangadex.ParseArchiveFormat(string(env.Format)); err != nil {
+		return nil, err
+	}
+	if _, err := imaging.New(env.Processing, false); err != nil {
+		return nil, err
+	}
+	for mangaID, mangaConfig := range env.Manga {
+		if mangaConfig.Packaging != "" {
+			if _, err := mangadex.ParsePackaging(string(mangaConfig.Packaging)); err != nil {
+				return nil, fmt.Errorf("manga %v: %w", mangaID, err)
+			}
+		}
+		if mangaConfig.Format != "" {
+			if _, err := mangadex.ParseArchiveFormat(string(mangaConfig.Format)); err != nil {
+				return nil, fmt.Errorf("manga %v: %w", mangaID, err)
+			}
+		}
+		if mangaConfig.Spreads != "" {
+			if _, err := mangadex.ParseSpreadMode(string(mangaConfig.Spreads)); err != nil {
+				return nil, fmt.Errorf("manga %v: %w", mangaID, err)
+			}
+		}
+	}
 
 	log.Printf("Loaded config\n")
 	log.Printf("Using %v as download folder \n", env.DownloadPath)
@@ -61,6 +158,12 @@ func SaveConfig(env *mangadex.EnvConfigs) error {
 	}
 
 	viper.SetConfigFile(configFile)
+	// Keep the options that were added to an existing configuration by hand
+	if alreadyExists {
+		if err := viper.ReadInConfig(); err != nil {
+			return err
+		}
+	}
 
 	if err := viper.MergeConfigMap(map[string]interface{}{
 		"Username":     env.Username,
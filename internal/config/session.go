@@ -0,0 +1,57 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"godex/internal/mangadex"
+	"os"
+	"path/filepath"
+
+	gap "github.com/muesli/go-app-paths"
+)
+
+const sessionFile = "session.json"
+
+// SessionStore keeps the MangaDex session in the godex data directory.
+type SessionStore struct{}
+
+// LoadSession reads the saved session, returning nil if godex never logged in before.
+func (SessionStore) LoadSession() (*mangadex.Session, error) {
+	scope := gap.NewScope(gap.User, "godex")
+	dataFile, err := scope.DataPath(sessionFile)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(dataFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading session: %v", err)
+	}
+	session := &mangadex.Session{}
+	if err := json.Unmarshal(content, session); err != nil {
+		return nil, fmt.Errorf("error parsing session: %v", err)
+	}
+	return session, nil
+}
+
+// SaveSession writes the session to the godex data directory, readable only by the current user.
+func (SessionStore) SaveSession(session *mangadex.Session) error {
+	scope := gap.NewScope(gap.User, "godex")
+	dataFile, err := scope.DataPath(sessionFile)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dataFile), 0755); err != nil {
+		return err
+	}
+	content, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("error marshalling session: %v", err)
+	}
+	if err := os.WriteFile(dataFile, content, 0600); err != nil {
+		return fmt.Errorf("error saving session: %v", err)
+	}
+	return nil
+}
@@ -2,9 +2,7 @@ package config
 
 import (
 	"fmt"
-	"godex/internal/util"
 	"log"
-	"os"
 	"time"
 
 	gap "github.com/muesli/go-app-paths"
@@ -16,51 +14,8 @@ const (
 	timestampFile = "timestamp"
 )
 
-func timestampFileExists() (bool, error) {
-	scope := gap.NewScope(gap.User, "godex")
-	configPath, err := scope.DataPath(timestampFile)
-	if err != nil {
-		return false, err
-	}
-	_, err = os.Stat(configPath)
-	return err == nil, nil
-}
-
-func SaveTimestamp() error {
-	scope := gap.NewScope(gap.User, "godex")
-	dataFile, err := scope.DataPath(timestampFile)
-	if err != nil {
-		return err
-	}
-
-	alreadyExists, err := timestampFileExists()
-	if err != nil {
-		return err
-	}
-	if !alreadyExists {
-		err = util.CreateFileAndDir(dataFile)
-		if err != nil {
-			return err
-		}
-	}
-	now := time.Now()
-
-	// Initialize Viper
-	v := viper.New()
-	v.SetConfigType("json")
-
-	// Set the timestamp value
-	v.Set(timestampKey, now.Format(time.RFC3339))
-
-	// Write the configuration to file
-	err = v.WriteConfigAs(dataFile)
-	if err != nil {
-		return fmt.Errorf("error saving timestamp: %v", err)
-	}
-
-	return nil
-}
-
+// LoadTimestamp loads the last run timestamp written by godex before the library kept track of it.
+// When there is no such timestamp, it defaults to a week ago.
 func LoadTimestamp() (time.Time, error) {
 	scope := gap.NewScope(gap.User, "godex")
 	dataFile, err := scope.DataPath(timestampFile)
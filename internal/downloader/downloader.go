@@ -4,102 +4,394 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"godex/internal/archive"
+	"godex/internal/comicinfo"
 	"godex/internal/downloader/sources"
+	"godex/internal/imaging"
+	"godex/internal/library"
 	"godex/internal/mangadex"
+	"godex/internal/naming"
 	"godex/internal/util"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 )
 
+// errUnknownSource is returned for chapters hosted on a site none of the sources can download from.
+var errUnknownSource = errors.New("unknown source")
+
+// errUnsupportedPages is returned for chapters whose pages can't be stored in the archive format of their manga.
+var errUnsupportedPages = errors.New("unsupported page format")
+
 type Downloader struct {
 	httpClient *resty.Client
 	cfg        *mangadex.Config
+	library    *library.Library
+	template   *naming.Template
+	// volumeTemplate lays out volume archives when chapters are packed into volumes.
+	volumeTemplate *naming.Template
+	sources        []sources.Source
 }
 
-func NewDownloader(cfg *mangadex.Config, httpClient *resty.Client) *Downloader {
-	return &Downloader{
-		httpClient: httpClient,
-		cfg:        cfg,
+// NewDownloader creates a downloader laying out archives according to the configured path templates.
+func NewDownloader(cfg *mangadex.Config, httpClient *resty.Client, lib *library.Library) (*Downloader, error) {
+	template, err := naming.Parse(cfg.Filenames.Template)
+	if err != nil {
+		return nil, err
 	}
-}
-
-var downloadSources = []sources.Source{
-	&sources.MangaPlus{},
-	&sources.Mangadex{},
+	volumeTemplate, err := naming.Parse(cfg.Filenames.VolumeTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return &Downloader{
+		httpClient:     httpClient,
+		cfg:            cfg,
+		library:        lib,
+		template:       template,
+		volumeTemplate: volumeTemplate,
+		sources: []sources.Source{
+			&sources.MangaPlus{Quality: cfg.ImageQuality, Validation: cfg.PageValidation},
+			&sources.Mangadex{Quality: cfg.ImageQuality, Validation: cfg.PageValidation},
+		},
+	}, nil
 }
 
 // DownloadManga downloads a list of manga.
 // It takes a context, an authentication token, and a list of manga
-// It returns an error if any operation fails.
+// Every manga, chapter and download is saved in the library along the way,
+// along with the sync status of each chapter so failed ones can be retried.
+// It returns an error if any operation fails, once the background work of the sources is done.
 func (d *Downloader) DownloadManga(ctx context.Context, mangaList []*mangadex.GodexManga, mangadexClient *mangadex.Client) error {
+	defer d.waitSources()
 	err := util.CreateDownloadDir(d.cfg.DownloadPath)
 	if err != nil {
 		return err
 	}
-	var errs []string
+	var errs []error
 
 	for _, manga := range mangaList {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			log.Printf("Downloading manga: %v", manga.Manga.Attributes.Title.Values["en"])
-			mangaDir, err := util.CreateMangaDir(d.cfg.DownloadPath, manga)
+			languages := d.cfg.MangaLanguages(manga.Manga.ID)
+			title := manga.Manga.Title(languages)
+			log.Printf("Downloading manga: %v", title)
 			chaptersToMarkAsRead := make([]string, 0)
+			err = d.library.SaveManga(ctx, manga.Manga)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			folder, err := d.mangaFolder(ctx, manga.Manga, title)
 			if err != nil {
-				errs = append(errs, fmt.Sprintf("failed to create manga directory: %v", err))
+				errs = append(errs, err)
 				continue
 			}
-			for _, chapter := range manga.Chapters {
-				downloaded, err := d.downloadChapter(ctx, mangaDir, chapter)
+			chapters := selectChapters(manga.Chapters, d.cfg.DuplicateChapters, d.cfg.MangaPreferredGroups(manga.Manga.ID))
+			if skipped := len(manga.Chapters) - len(chapters); skipped > 0 {
+				log.Printf("Skipped %v duplicate chapters (%v)", skipped, d.cfg.DuplicateChapters)
+			}
+			for _, chapter := range chapters {
+				downloaded, err := d.downloadChapter(ctx, manga.Manga, languages, folder, chapter)
+				if statusErr := d.library.SetChapterStatus(ctx, chapter.Chapter.ID, chapterStatus(err), err); statusErr != nil {
+					errs = append(errs, statusErr)
+				}
 				if err != nil {
-					errs = append(errs, fmt.Sprintf("failed to download chapter: %v", err))
+					errs = append(errs, fmt.Errorf("failed to download chapter: %w", err))
 					continue
 				} else {
-					chapterNumber := chapter.Chapter.Attributes.Chapter
 					if downloaded {
-						log.Printf("Downloaded chapter: %v", *chapterNumber)
+						log.Printf("Downloaded chapter: %v (%v)", chapter.Chapter.Label(), chapter.Quality)
 						chaptersToMarkAsRead = append(chaptersToMarkAsRead, chapter.Chapter.ID)
 					} else {
-						log.Printf("Skipped chapter: %v", *chapterNumber)
+						log.Printf("Skipped chapter: %v", chapter.Chapter.Label())
 					}
 				}
 			}
+			if d.cfg.MangaPackaging(manga.Manga.ID) == mangadex.PackageVolumes {
+				if err := d.packVolumes(ctx, mangadexClient, manga.Manga, languages, folder); err != nil {
+					errs = append(errs, fmt.Errorf("failed to pack volumes: %w", err))
+				}
+			}
 			readErr := mangadexClient.MarkMangaAsRead(ctx, manga.Manga.ID, chaptersToMarkAsRead)
 			if readErr != nil {
-				errs = append(errs, fmt.Sprintf("failed to mark manga as read: %v", readErr))
+				errs = append(errs, fmt.Errorf("failed to mark manga as read: %w", readErr))
 				continue
 			}
 		}
 	}
 
-	if len(errs) > 0 {
-		return errors.New(strings.Join(errs, "\n"))
+	return errors.Join(errs...)
+}
+
+// waitSources waits for the sources still working in the background, like the MangaDex@Home reports being sent.
+func (d *Downloader) waitSources() {
+	for _, source := range d.sources {
+		if waiter, ok := source.(sources.Waiter); ok {
+			waiter.Wait()
+		}
 	}
-	return nil
 }
 
-// downloadChapter Downloads a chapter from any of the available sources and compresses it into a cbz in the according folder
+// downloadChapter Downloads a chapter from any of the available sources and archives it in the format of the manga at the path given by the template
 // it returns a bool indicating whether the chapter was successfully downloaded and an error indicating if any error happened during download.
-func (d *Downloader) downloadChapter(ctx context.Context, mangaDir string, chapter *mangadex.GodexChapter) (bool, error) {
+// Pages are processed for the configured e-reader before they are archived, and the archive embeds a ComicInfo document describing the chapter.
+// The quality the chapter was downloaded in is recorded on the chapter, and the download is saved in the library.
+func (d *Downloader) downloadChapter(ctx context.Context, manga *mangadex.Manga, languages []string, folder string, chapter *mangadex.GodexChapter) (bool, error) {
 	actualChapter := chapter.Chapter
-	if util.CheckChapterAlreadyExists(mangaDir, *actualChapter.Attributes.Chapter) {
-		return false, nil
+	err := d.library.SaveChapter(ctx, manga.ID, actualChapter)
+	if err != nil {
+		return false, err
 	}
-	for _, source := range downloadSources {
+	writer, err := d.writer(manga.ID)
+	if err != nil {
+		return false, err
+	}
+	chapterPath, err := d.chapterPath(ctx, manga, languages, folder, actualChapter, writer.Extension())
+	if err != nil {
+		return false, err
+	}
+	alreadyDownloaded, err := d.isDownloaded(ctx, manga.ID, chapterPath, writer.Extension(), actualChapter)
+	if err != nil || alreadyDownloaded {
+		return false, err
+	}
+	for _, source := range d.sources {
 		if source.IsValid(actualChapter) {
-			chapterDir, err := util.CreateChapterDir(mangaDir, actualChapter)
+			// Pages are staged away from the archive path, which could name a folder holding other archives
+			chapterDir, err := os.MkdirTemp(d.cfg.DownloadPath, ".chapter-")
 			if err != nil {
-				return false, err
+				return false, fmt.Errorf("error creating chapter directory: %w", err)
+			}
+			defer os.RemoveAll(chapterDir)
+			archivePath := util.ChapterArchivePath(d.cfg.DownloadPath, chapterPath, writer.Extension())
+			if err := os.MkdirAll(filepath.Dir(archivePath), 0755); err != nil {
+				return false, fmt.Errorf("error creating directory for %v: %w", archivePath, err)
+			}
+			var pages int
+			var book *archive.Book
+			chapter.Quality, err = source.DownloadChapterImages(ctx, d.httpClient, chapterDir, actualChapter)
+			if err == nil {
+				err = d.processPages(manga, chapterDir)
+			}
+			if err == nil {
+				book, err = chapterBook(manga, actualChapter, languages, chapterDir)
+			}
+			if err == nil {
+				pages, err = writer.Write(chapterDir, archivePath, book)
 			}
-			err = source.DownloadChapterImages(ctx, d.httpClient, chapterDir, actualChapter)
 			if err != nil {
 				return false, err
 			}
-			return true, util.CreateCBZ(chapterDir)
+			return true, d.recordDownload(ctx, actualChapter, source.Name(), chapter.Quality, pages, archivePath)
+		}
+	}
+	externalURL := ""
+	if actualChapter.Attributes.ExternalURL != nil {
+		externalURL = *actualChapter.Attributes.ExternalURL
+	}
+	return false, fmt.Errorf("cannot download chapter %v : %w %s", actualChapter.Label(), errUnknownSource, externalURL)
+}
+
+// mangaFolder returns the name of the folder of a manga in the download directory.
+// The name is computed from the title the first time the manga is downloaded and kept in the library afterwards,
+// so a title changing on MangaDex doesn't create a second folder.
+// Different manga sharing a title get the start of their ID appended to tell their folders apart.
+func (d *Downloader) mangaFolder(ctx context.Context, manga *mangadex.Manga, title string) (string, error) {
+	folder, err := d.library.MangaFolder(ctx, manga.ID)
+	if err != nil || folder != "" {
+		return folder, err
+	}
+	folder = util.SanitizeFilename(title, d.cfg.Filenames)
+	if folder == "" {
+		folder = manga.ID
+	}
+	taken, err := d.library.FolderTaken(ctx, folder, manga.ID)
+	if err != nil {
+		return "", err
+	}
+	if taken {
+		folder = fmt.Sprintf("%v (%v)", folder, strings.SplitN(manga.ID, "-", 2)[0])
+	}
+	return folder, d.library.SetMangaFolder(ctx, manga.ID, folder)
+}
+
+// chapterPath returns the path of a chapter relative to the download directory, without extension.
+// When the archive with the given extension at that path belongs to another chapter, as with untitled oneshots
+// or releases without a group when every release is kept, the start of the chapter ID is appended to the name.
+// It fails rather than returning a path whose archive would overwrite the one of another chapter.
+func (d *Downloader) chapterPath(ctx context.Context, manga *mangadex.Manga, languages []string, folder string, chapter *mangadex.Chapter, extension string) (string, error) {
+	keepAll := d.cfg.DuplicateChapters == mangadex.DuplicateKeepAll
+	fields := naming.NewFields(folder, manga.Title(languages), chapter, keepAll)
+	fields.MangaID = manga.ID
+	chapterPath, err := d.template.Path(fields, d.cfg.Filenames)
+	if err != nil {
+		return "", err
+	}
+	owner, err := d.archiveOwner(ctx, util.ChapterArchivePath(d.cfg.DownloadPath, chapterPath, extension))
+	if err != nil || owner == "" || owner == chapter.ID {
+		return chapterPath, err
+	}
+	chapterPath = fmt.Sprintf("%v (%v)", chapterPath, strings.SplitN(chapter.ID, "-", 2)[0])
+	owner, err = d.archiveOwner(ctx, util.ChapterArchivePath(d.cfg.DownloadPath, chapterPath, extension))
+	if err != nil || owner == "" || owner == chapter.ID {
+		return chapterPath, err
+	}
+	return "", fmt.Errorf("cannot name chapter %v, %v already belongs to chapter %v", chapter.Label(), chapterPath, owner)
+}
+
+// archiveOwner returns the ID of the chapter whose archive is at the given path, or "volume" for a volume archive.
+// It returns an empty string when the library has no archive there.
+func (d *Downloader) archiveOwner(ctx context.Context, archivePath string) (string, error) {
+	download, err := d.library.DownloadByPath(ctx, archivePath)
+	if err != nil {
+		return "", err
+	}
+	if download != nil {
+		return download.ChapterID, nil
+	}
+	volume, err := d.library.VolumeByPath(ctx, archivePath)
+	if err != nil || volume == nil {
+		return "", err
+	}
+	return "volume", nil
+}
+
+// writer returns the archive writer of the format a manga is saved in.
+func (d *Downloader) writer(mangaID string) (archive.Writer, error) {
+	return archive.New(d.cfg.MangaFormat(mangaID))
+}
+
+// processPages names the downloaded pages of a chapter after their actual format, and processes them for the configured e-reader, if any.
+// PDF documents can only hold the pages Go decodes, so chapters with AVIF pages can't be archived in PDF.
+func (d *Downloader) processPages(manga *mangadex.Manga, chapterDir string) error {
+	processing := d.cfg.MangaProcessing(manga.ID)
+	if err := imaging.NormalizePages(chapterDir, d.cfg.MangaTranscode(manga.ID)); err != nil {
+		return err
+	}
+	pipeline, err := imaging.New(processing, manga.RightToLeft())
+	if err != nil {
+		return err
+	}
+	if pipeline != nil {
+		if err := pipeline.ProcessDir(chapterDir); err != nil {
+			return err
 		}
 	}
-	return false, fmt.Errorf("cannot download chapter %v : unknown source %s", *actualChapter.Attributes.Chapter, *actualChapter.Attributes.ExternalURL)
+	if d.cfg.MangaFormat(manga.ID) != mangadex.FormatPDF {
+		return nil
+	}
+	undecodable, err := imaging.UndecodablePages(chapterDir)
+	if err != nil || len(undecodable) == 0 {
+		return err
+	}
+	return fmt.Errorf("cannot archive %v in PDF: %w", strings.Join(undecodable, ", "), errUnsupportedPages)
+}
+
+// chapterBook describes a chapter to its archive, along with its ComicInfo document.
+func chapterBook(manga *mangadex.Manga, chapter *mangadex.Chapter, languages []string, chapterDir string) (*archive.Book, error) {
+	info, err := comicinfo.New(manga, chapter, languages, chapterDir)
+	if err != nil {
+		return nil, err
+	}
+	return &archive.Book{
+		ID:          "urn:uuid:" + chapter.ID,
+		Title:       info.Series + " - " + chapter.Label(),
+		Series:      info.Series,
+		Language:    info.LanguageISO,
+		Description: info.Summary,
+		RightToLeft: info.RightToLeft(),
+		Sections:    []archive.Section{{Title: chapter.Label()}},
+		ComicInfo:   info,
+	}, nil
+}
+
+// chapterStatus returns the sync status of a chapter after trying to download it.
+// Chapters MangaDex doesn't know about anymore, that no source can download, or whose pages the archive format can't hold, won't be retried.
+func chapterStatus(err error) library.ChapterStatus {
+	if err == nil {
+		return library.ChapterDone
+	}
+	if errors.Is(err, errUnknownSource) || errors.Is(err, errUnsupportedPages) {
+		return library.ChapterUnavailable
+	}
+	var apiErr *mangadex.APIError
+	if errors.As(err, &apiErr) && apiErr.IsNotFound() {
+		return library.ChapterUnavailable
+	}
+	return library.ChapterFailed
+}
+
+// isDownloaded checks the library for a download of the chapter whose archive is still on disk.
+// Any release of the same chapter number counts, unless every release is kept; oneshots are looked up by ID.
+// The archive of the chapter itself is moved to its current template path if it was saved elsewhere.
+// Archives keep the format they were saved in, changing the format of a manga only applies to the chapters downloaded afterwards.
+// Archives downloaded before the library existed are added to it as they are found, with an unknown source and quality.
+func (d *Downloader) isDownloaded(ctx context.Context, mangaID string, chapterPath string, extension string, chapter *mangadex.Chapter) (bool, error) {
+	var download *library.Download
+	var err error
+	number := chapter.Attributes.Chapter
+	if number == nil || *number == "" || d.cfg.DuplicateChapters == mangadex.DuplicateKeepAll {
+		download, err = d.library.ChapterDownload(ctx, chapter.ID)
+	} else {
+		download, err = d.library.FindDownload(ctx, mangaID, *number)
+	}
+	if err != nil {
+		return false, err
+	}
+	if download != nil {
+		if !util.CheckFileExists(download.Path) {
+			return false, nil
+		}
+		archivePath := util.ChapterArchivePath(d.cfg.DownloadPath, chapterPath, archive.Extension(download.Path))
+		if download.ChapterID != chapter.ID || download.Path == archivePath {
+			return true, nil
+		}
+		// Chapters packed into a volume stay in it
+		volume, err := d.library.VolumeByPath(ctx, download.Path)
+		if err != nil || volume != nil {
+			return true, err
+		}
+		return true, d.moveDownload(ctx, download, archivePath)
+	}
+	archivePath := util.ChapterArchivePath(d.cfg.DownloadPath, chapterPath, extension)
+	if !util.CheckFileExists(archivePath) {
+		return false, nil
+	}
+	return true, d.recordDownload(ctx, chapter, "unknown", "", 0, archivePath)
+}
+
+// moveDownload renames the archive of a download to a new path, unless a file is already there.
+func (d *Downloader) moveDownload(ctx context.Context, download *library.Download, archivePath string) error {
+	if util.CheckFileExists(archivePath) {
+		log.Printf("Not moving %v, %v already exists", download.Path, archivePath)
+		return nil
+	}
+	if err := util.MoveFile(download.Path, archivePath); err != nil {
+		return err
+	}
+	log.Printf("Moved %v to %v", download.Path, archivePath)
+	download.Path = archivePath
+	return d.library.RecordDownload(ctx, download)
+}
+
+// recordDownload saves the archive of a chapter in the library.
+func (d *Downloader) recordDownload(ctx context.Context, chapter *mangadex.Chapter, source string, quality mangadex.ImageQuality, pages int, archivePath string) error {
+	hash, err := util.HashFile(archivePath)
+	if err != nil {
+		return fmt.Errorf("error hashing %v: %w", archivePath, err)
+	}
+	return d.library.RecordDownload(ctx, &library.Download{
+		ChapterID:    chapter.ID,
+		Source:       source,
+		Quality:      quality,
+		Pages:        pages,
+		Path:         archivePath,
+		Hash:         hash,
+		DownloadedAt: time.Now(),
+	})
 }
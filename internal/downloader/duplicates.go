@@ -0,0 +1,68 @@
+package downloader
+
+import (
+	"godex/internal/mangadex"
+	"sort"
+)
+
+// selectChapters applies the duplicate chapters policy to the chapters of a manga.
+// Chapters sharing a number are ordered by publication date, then ID, so the same release is always kept.
+// Oneshots have no number and are never considered duplicates.
+// The kept chapters are returned in their original order.
+func selectChapters(chapters []*mangadex.GodexChapter, policy mangadex.DuplicatePolicy, preferredGroups []string) []*mangadex.GodexChapter {
+	if policy == mangadex.DuplicateKeepAll {
+		return chapters
+	}
+
+	releases := make(map[string][]*mangadex.GodexChapter)
+	for _, chapter := range chapters {
+		number := chapter.Chapter.Attributes.Chapter
+		if number != nil && *number != "" {
+			releases[*number] = append(releases[*number], chapter)
+		}
+	}
+
+	kept := make(map[*mangadex.GodexChapter]bool, len(releases))
+	for _, candidates := range releases {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			a, b := candidates[i].Chapter, candidates[j].Chapter
+			if a.Attributes.PublishAt != b.Attributes.PublishAt {
+				return a.Attributes.PublishAt < b.Attributes.PublishAt
+			}
+			return a.ID < b.ID
+		})
+		best := candidates[0]
+		if policy == mangadex.DuplicatePreferGroup {
+			bestRank := groupRank(best.Chapter, preferredGroups)
+			for _, candidate := range candidates[1:] {
+				if rank := groupRank(candidate.Chapter, preferredGroups); rank < bestRank {
+					best, bestRank = candidate, rank
+				}
+			}
+		}
+		kept[best] = true
+	}
+
+	selected := make([]*mangadex.GodexChapter, 0, len(chapters))
+	for _, chapter := range chapters {
+		number := chapter.Chapter.Attributes.Chapter
+		if number == nil || *number == "" || kept[chapter] {
+			selected = append(selected, chapter)
+		}
+	}
+	return selected
+}
+
+// groupRank returns the position of the most preferred group of a chapter in the preferred groups,
+// or the number of preferred groups if none of its groups is preferred.
+func groupRank(chapter *mangadex.Chapter, preferredGroups []string) int {
+	rank := len(preferredGroups)
+	for _, group := range chapter.Groups() {
+		for i, preferred := range preferredGroups {
+			if i < rank && group.Matches(preferred) {
+				rank = i
+			}
+		}
+	}
+	return rank
+}
@@ -0,0 +1,437 @@
+package downloader
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"godex/internal/archive"
+	"godex/internal/comicinfo"
+	"godex/internal/library"
+	"godex/internal/mangadex"
+	"godex/internal/util"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Rename : The move of a chapter or volume archive to the path given by the path templates.
+type Rename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// ChapterID is empty for volume archives.
+	ChapterID string `json:"chapterId,omitempty"`
+	// remote is the manga and chapter matched on MangaDex, saved in the library when the rename is applied.
+	remote *remoteMatch
+}
+
+// remoteMatch : A chapter archive matched to a chapter found on MangaDex, which the library doesn't know yet.
+type remoteMatch struct {
+	manga   *mangadex.Manga
+	chapter *mangadex.Chapter
+	// folder is the folder the manga is given, empty when it keeps the one it has or the folder belongs to another manga.
+	folder string
+}
+
+// PlanRenames walks the download directory and computes where every archive belongs according to the path templates.
+// Volume archives are known from the library. Chapter archives are matched to chapters of the library by their recorded path, then by the link in their ComicInfo document,
+// then by their manga folder and their file name as a chapter number, looking the manga and chapter up on MangaDex when the library doesn't know them.
+// It returns the archives to move along with a description of the ones left in place. The library is left untouched.
+func (d *Downloader) PlanRenames(ctx context.Context, client *mangadex.Client) ([]Rename, []string, error) {
+	var renames []Rename
+	var skipped []string
+	planned := make(map[string]bool)
+	lookups := &remoteLookups{client: client, manga: make(map[string]*remoteManga)}
+
+	err := filepath.WalkDir(d.cfg.DownloadPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		extension := archive.Extension(path)
+		if entry.IsDir() || extension == "" {
+			return nil
+		}
+		volume, err := d.library.VolumeByPath(ctx, path)
+		if err != nil {
+			return err
+		}
+		var chapterID, archivePath string
+		var remote *remoteMatch
+		if volume != nil {
+			archivePath, err = d.volumePath(ctx, volume.MangaID, volume.Volume, extension)
+		} else {
+			chapterID, remote, err = d.matchArchive(ctx, lookups, path)
+			if err != nil {
+				return err
+			}
+			switch {
+			case remote != nil:
+				chapterID = remote.chapter.ID
+				archivePath, err = d.remoteArchivePath(ctx, remote, extension)
+			case chapterID != "":
+				archivePath, err = d.archivePath(ctx, chapterID, extension)
+			default:
+				skipped = append(skipped, fmt.Sprintf("%v: no matching chapter in the library or on MangaDex", path))
+				return nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case archivePath == "":
+			skipped = append(skipped, fmt.Sprintf("%v: its chapters or manga are missing from the library", path))
+		case archivePath == path:
+		case planned[archivePath] || util.CheckFileExists(archivePath):
+			skipped = append(skipped, fmt.Sprintf("%v: %v already exists", path, archivePath))
+		default:
+			planned[archivePath] = true
+			renames = append(renames, Rename{From: path, To: archivePath, ChapterID: chapterID, remote: remote})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error walking the download directory: %w", err)
+	}
+	return renames, skipped, nil
+}
+
+// remoteLookups : The manga looked up on MangaDex while matching archives, keyed by folder so each folder is only looked up once.
+type remoteLookups struct {
+	client *mangadex.Client
+	// manga holds nil for the folders no manga was found for.
+	manga map[string]*remoteManga
+}
+
+// remoteManga : A manga found on MangaDex along with its chapters.
+type remoteManga struct {
+	manga    *mangadex.Manga
+	chapters []*mangadex.GodexChapter
+}
+
+// matchArchive finds the ID of the chapter of the library an archive holds, or else the chapter of MangaDex it holds.
+// Both are empty if it can't be told.
+func (d *Downloader) matchArchive(ctx context.Context, lookups *remoteLookups, path string) (string, *remoteMatch, error) {
+	download, err := d.library.DownloadByPath(ctx, path)
+	if err != nil {
+		return "", nil, err
+	}
+	if download != nil {
+		return download.ChapterID, nil, nil
+	}
+
+	info, err := comicinfo.ReadArchive(path)
+	if err != nil {
+		log.Printf("Could not read ComicInfo of %v: %v", path, err)
+	} else if info != nil && info.ChapterID() != "" {
+		chapter, _, err := d.library.Chapter(ctx, info.ChapterID())
+		if err != nil || chapter != nil {
+			return info.ChapterID(), nil, err
+		}
+	}
+
+	rel, err := filepath.Rel(d.cfg.DownloadPath, path)
+	if err != nil {
+		return "", nil, err
+	}
+	folder, _, found := strings.Cut(filepath.ToSlash(rel), "/")
+	if !found {
+		return "", nil, nil
+	}
+	number := strings.TrimSuffix(filepath.Base(path), archive.Extension(path))
+	mangaID, err := d.library.MangaByFolder(ctx, folder)
+	if err != nil {
+		return "", nil, err
+	}
+	if mangaID != "" {
+		chapterID, err := d.library.ChapterByNumber(ctx, mangaID, number)
+		if err != nil || chapterID != "" {
+			return chapterID, nil, err
+		}
+	}
+	remote, err := d.matchRemote(ctx, lookups, folder, mangaID, number)
+	return "", remote, err
+}
+
+// matchRemote looks up the chapter of a manga folder with the given number on MangaDex.
+// The manga is searched by the title of the folder, unless the library already knows which one it holds.
+// It returns nil if MangaDex has no such manga or chapter.
+func (d *Downloader) matchRemote(ctx context.Context, lookups *remoteLookups, folder string, mangaID string, number string) (*remoteMatch, error) {
+	remote, ok := lookups.manga[folder]
+	if !ok {
+		var err error
+		remote, err = d.findManga(ctx, lookups.client, folder, mangaID)
+		if err != nil {
+			return nil, err
+		}
+		lookups.manga[folder] = remote
+	}
+	if remote == nil {
+		return nil, nil
+	}
+
+	var chapter *mangadex.Chapter
+	for _, candidate := range selectChapters(remote.chapters, d.cfg.DuplicateChapters, d.cfg.MangaPreferredGroups(remote.manga.ID)) {
+		if n := candidate.Chapter.Attributes.Chapter; n != nil && *n == number {
+			chapter = candidate.Chapter
+			break
+		}
+	}
+	if chapter == nil {
+		return nil, nil
+	}
+
+	match := &remoteMatch{manga: remote.manga, chapter: chapter}
+	current, err := d.library.MangaFolder(ctx, remote.manga.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current == "" {
+		taken, err := d.library.FolderTaken(ctx, folder, remote.manga.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !taken {
+			match.folder = folder
+		}
+	}
+	return match, nil
+}
+
+// saveRemote saves a manga and chapter matched on MangaDex in the library, giving the manga its folder if it has none yet.
+func (d *Downloader) saveRemote(ctx context.Context, match *remoteMatch) error {
+	if err := d.library.SaveManga(ctx, match.manga); err != nil {
+		return err
+	}
+	if match.folder != "" {
+		current, err := d.library.MangaFolder(ctx, match.manga.ID)
+		if err != nil {
+			return err
+		}
+		if current == "" {
+			if err := d.library.SetMangaFolder(ctx, match.manga.ID, match.folder); err != nil {
+				return err
+			}
+		}
+	}
+	if err := d.library.SaveChapter(ctx, match.manga.ID, match.chapter); err != nil {
+		return err
+	}
+	// The chapter is on disk already, the next sync mustn't take it for a chapter left to download
+	return d.library.SetChapterStatus(ctx, match.chapter.ID, library.ChapterDone, nil)
+}
+
+// findManga finds the manga a folder holds on MangaDex, along with its chapters.
+// Without a manga ID, the folder name has to be one of the titles of a manga found by searching for it, as is or once sanitized.
+// It returns nil if no manga matches.
+func (d *Downloader) findManga(ctx context.Context, client *mangadex.Client, folder string, mangaID string) (*remoteManga, error) {
+	var manga *mangadex.Manga
+	var err error
+	if mangaID != "" {
+		manga, err = d.library.Manga(ctx, mangaID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		results, err := client.SearchManga(ctx, folder)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			if d.titleMatches(result, folder) {
+				manga = result
+				break
+			}
+		}
+	}
+	if manga == nil {
+		log.Printf("Could not find the manga of folder %v on MangaDex", folder)
+		return nil, nil
+	}
+	chapters, err := client.MangaChapters(ctx, manga.ID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Matched folder %v to manga %v on MangaDex", folder, manga.ID)
+	return &remoteManga{manga: manga, chapters: chapters}, nil
+}
+
+// titleMatches tells if a folder is named after one of the titles of a manga, ignoring case.
+func (d *Downloader) titleMatches(manga *mangadex.Manga, folder string) bool {
+	for _, titles := range []mangadex.LocalisedStrings{manga.Attributes.Title, manga.Attributes.AltTitles} {
+		for _, title := range titles.Values {
+			if strings.EqualFold(title, folder) || strings.EqualFold(util.SanitizeFilename(title, d.cfg.Filenames), folder) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// archivePath returns the path of the archive of a chapter of the library according to the path template.
+// The archive keeps its extension, so archives saved in another format than the current one stay as they are.
+// It returns an empty string if the chapter or its manga isn't in the library.
+func (d *Downloader) archivePath(ctx context.Context, chapterID string, extension string) (string, error) {
+	chapter, mangaID, err := d.library.Chapter(ctx, chapterID)
+	if err != nil || chapter == nil {
+		return "", err
+	}
+	manga, err := d.library.Manga(ctx, mangaID)
+	if err != nil || manga == nil {
+		return "", err
+	}
+	languages := d.cfg.MangaLanguages(mangaID)
+	folder, err := d.libraryFolder(ctx, manga, languages)
+	if err != nil {
+		return "", err
+	}
+	return d.templateArchivePath(ctx, manga, languages, folder, chapter, extension)
+}
+
+// remoteArchivePath returns the path of the archive of a chapter matched on MangaDex according to the path template,
+// as it will be once the manga and chapter are saved in the library.
+func (d *Downloader) remoteArchivePath(ctx context.Context, match *remoteMatch, extension string) (string, error) {
+	languages := d.cfg.MangaLanguages(match.manga.ID)
+	folder := match.folder
+	if folder == "" {
+		var err error
+		folder, err = d.libraryFolder(ctx, match.manga, languages)
+		if err != nil {
+			return "", err
+		}
+	}
+	return d.templateArchivePath(ctx, match.manga, languages, folder, match.chapter, extension)
+}
+
+// templateArchivePath returns the path of the archive of a chapter in the given manga folder according to the path template.
+func (d *Downloader) templateArchivePath(ctx context.Context, manga *mangadex.Manga, languages []string, folder string, chapter *mangadex.Chapter, extension string) (string, error) {
+	chapterPath, err := d.chapterPath(ctx, manga, languages, folder, chapter, extension)
+	if err != nil {
+		return "", err
+	}
+	return util.ChapterArchivePath(d.cfg.DownloadPath, chapterPath, extension), nil
+}
+
+// volumePath returns the path of the archive of a volume of the library according to the volume path template.
+// It returns an empty string if the manga or the chapters of the volume aren't in the library.
+func (d *Downloader) volumePath(ctx context.Context, mangaID string, volume string, extension string) (string, error) {
+	manga, err := d.library.Manga(ctx, mangaID)
+	if err != nil || manga == nil {
+		return "", err
+	}
+	_, chapters, err := d.volumeChapters(ctx, mangaID, volume)
+	if err != nil || len(chapters) == 0 {
+		return "", err
+	}
+	languages := d.cfg.MangaLanguages(mangaID)
+	folder, err := d.libraryFolder(ctx, manga, languages)
+	if err != nil {
+		return "", err
+	}
+	return d.volumeArchivePath(manga, languages, folder, volume, chapters, extension)
+}
+
+// libraryFolder returns the folder of a manga as recorded in the library, or the one its title would give.
+func (d *Downloader) libraryFolder(ctx context.Context, manga *mangadex.Manga, languages []string) (string, error) {
+	folder, err := d.library.MangaFolder(ctx, manga.ID)
+	if err != nil || folder != "" {
+		return folder, err
+	}
+	return util.SanitizeFilename(manga.Title(languages), d.cfg.Filenames), nil
+}
+
+// ApplyRenames moves the archives and updates their path in the library.
+// The manga and chapters matched on MangaDex are saved in the library as their archives are moved.
+// Every rename is written to the journal before the archive is moved, so the whole run can be rolled back.
+func (d *Downloader) ApplyRenames(ctx context.Context, renames []Rename, journalPath string) error {
+	journal, err := os.OpenFile(journalPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("error creating rename journal: %w", err)
+	}
+	defer journal.Close()
+
+	encoder := json.NewEncoder(journal)
+	for _, rename := range renames {
+		if err := encoder.Encode(rename); err != nil {
+			return fmt.Errorf("error writing rename journal: %w", err)
+		}
+		if err := journal.Sync(); err != nil {
+			return fmt.Errorf("error writing rename journal: %w", err)
+		}
+		if err := util.MoveFile(rename.From, rename.To); err != nil {
+			return err
+		}
+		if rename.remote != nil {
+			if err := d.saveRemote(ctx, rename.remote); err != nil {
+				return err
+			}
+		}
+		if err := d.updateArchivePath(ctx, rename.ChapterID, rename.From, rename.To); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RollbackRenames moves the archives listed in the journal back where they were, last rename first.
+// Archives that were moved again since, or whose previous path is taken, are left alone.
+// The journal is removed once every archive is back.
+func (d *Downloader) RollbackRenames(ctx context.Context, journalPath string) error {
+	journal, err := os.Open(journalPath)
+	if err != nil {
+		return fmt.Errorf("error opening rename journal: %w", err)
+	}
+	var renames []Rename
+	scanner := bufio.NewScanner(journal)
+	for scanner.Scan() {
+		var rename Rename
+		if err := json.Unmarshal(scanner.Bytes(), &rename); err != nil {
+			journal.Close()
+			return fmt.Errorf("error reading rename journal: %w", err)
+		}
+		renames = append(renames, rename)
+	}
+	journal.Close()
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading rename journal: %w", err)
+	}
+
+	var errs []error
+	for i := len(renames) - 1; i >= 0; i-- {
+		rename := renames[i]
+		if !util.CheckFileExists(rename.To) || util.CheckFileExists(rename.From) {
+			log.Printf("Not moving back %v to %v", rename.To, rename.From)
+			continue
+		}
+		if err := util.MoveFile(rename.To, rename.From); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Printf("Moved %v back to %v", rename.To, rename.From)
+		if err := d.updateArchivePath(ctx, rename.ChapterID, rename.To, rename.From); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return os.Remove(journalPath)
+}
+
+// updateArchivePath points the downloads and the volume of an archive to its new path.
+// Chapter archives the library didn't know about are recorded with an unknown source and quality.
+func (d *Downloader) updateArchivePath(ctx context.Context, chapterID string, from string, to string) error {
+	if chapterID != "" {
+		download, err := d.library.ChapterDownload(ctx, chapterID)
+		if err != nil {
+			return err
+		}
+		if download == nil {
+			return d.recordDownload(ctx, &mangadex.Chapter{ID: chapterID}, "unknown", "", 0, to)
+		}
+	}
+	return d.library.MoveArchive(ctx, from, to)
+}
@@ -0,0 +1,162 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"godex/internal/httpclient"
+	"godex/internal/mangadex"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	reportEndpoint = "https://api.mangadex.network/report"
+	reportTimeout  = 10 * time.Second
+	// nodeFailureThreshold is how many failed fetches it takes to ask for a new MangaDex@Home node.
+	nodeFailureThreshold = 2
+)
+
+// atHomeReport : The payload MangaDex@Home expects after every image fetch from one of its nodes.
+type atHomeReport struct {
+	URL      string `json:"url"`
+	Success  bool   `json:"success"`
+	Bytes    int64  `json:"bytes"`
+	Duration int64  `json:"duration"`
+	Cached   bool   `json:"cached"`
+}
+
+// atHomeServer keeps track of the MangaDex@Home node serving a chapter, and replaces it when it keeps failing.
+type atHomeServer struct {
+	httpClient *resty.Client
+	chapterID  string
+	mu         sync.Mutex
+	data       *mangadex.MDHomeServerResponse
+	failures   int
+}
+
+// newAtHomeServer asks MangaDex for a node serving the given chapter.
+func newAtHomeServer(ctx context.Context, httpClient *resty.Client, chapterID string) (*atHomeServer, error) {
+	server := &atHomeServer{
+		httpClient: httpClient,
+		chapterID:  chapterID,
+	}
+	data, err := server.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(data.Chapter.Data) == 0 {
+		return nil, fmt.Errorf("no pages available for chapter %v", chapterID)
+	}
+	server.data = data
+	return server, nil
+}
+
+// fetch gets the base URL and page filenames of the chapter from the at-home server endpoint.
+func (s *atHomeServer) fetch(ctx context.Context) (*mangadex.MDHomeServerResponse, error) {
+	endpoint := fmt.Sprintf(downloadEndpoint, s.chapterID)
+	chapterData := &mangadex.MDHomeServerResponse{}
+	err := mangadex.CheckResponse(s.httpClient.R().SetContext(ctx).SetResult(chapterData).Get(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("error getting chapter list: %w", err)
+	}
+	return chapterData, nil
+}
+
+// current returns the node currently used for the chapter.
+func (s *atHomeServer) current() *mangadex.MDHomeServerResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data
+}
+
+// failed records a failed fetch from the given node.
+// Once the node reached nodeFailureThreshold failures, a new one is requested.
+// Failures from a node that was already replaced are ignored.
+func (s *atHomeServer) failed(ctx context.Context, failedNode *mangadex.MDHomeServerResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data != failedNode {
+		return nil
+	}
+	s.failures++
+	if s.failures < nodeFailureThreshold {
+		return nil
+	}
+
+	log.Printf("MangaDex@Home node %v keeps failing, requesting a new one", failedNode.BaseURL)
+	data, err := s.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	s.data = data
+	s.failures = 0
+	return nil
+}
+
+// fetch downloads an image into filePath, validates it and reports the outcome to MangaDex@Home.
+// Pages that don't pass validation are reported as failed fetches, so the node gets replaced when it keeps serving them.
+func (m *Mangadex) fetch(ctx context.Context, httpClient *resty.Client, imageUrl, filePath string) error {
+	start := time.Now()
+	// Pages are already retried by downloadPage, on a new node when needed
+	resp, err := httpClient.R().
+		SetContext(httpclient.WithoutRetries(ctx)).
+		SetOutput(filePath).
+		Get(imageUrl)
+	err = mangadex.CheckResponse(resp, err)
+	if err == nil {
+		err = m.validate(resp, imageUrl, filePath)
+	}
+
+	// Cancelled downloads say nothing about the node's health
+	if ctx.Err() == nil {
+		report := atHomeReport{
+			URL:      imageUrl,
+			Success:  err == nil,
+			Duration: time.Since(start).Milliseconds(),
+		}
+		if resp != nil {
+			report.Bytes = resp.Size()
+			report.Cached = strings.HasPrefix(resp.Header().Get("X-Cache"), "HIT")
+		}
+		m.report(httpClient, report)
+	}
+	return err
+}
+
+// validate checks a downloaded page against the size announced by the node and the hash in its file name.
+func (m *Mangadex) validate(resp *resty.Response, imageUrl, filePath string) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	contentLength := int64(-1)
+	if resp.RawResponse != nil {
+		contentLength = resp.RawResponse.ContentLength
+	}
+	return validatePage(content, contentLength, pageHash(imageUrl), m.Validation)
+}
+
+// report sends an image fetch report in the background.
+// Only nodes of the MangaDex@Home network are reported, not the mangadex.org servers.
+func (m *Mangadex) report(httpClient *resty.Client, report atHomeReport) {
+	u, err := url.Parse(report.URL)
+	if err != nil || strings.HasSuffix(u.Hostname(), "mangadex.org") {
+		return
+	}
+	m.reports.Add(1)
+	go func() {
+		defer m.reports.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+		defer cancel()
+		err := mangadex.CheckResponse(httpClient.R().SetContext(ctx).SetBody(report).Post(reportEndpoint))
+		if err != nil {
+			log.Printf("Could not report image fetch to MangaDex@Home: %v", err)
+		}
+	}()
+}
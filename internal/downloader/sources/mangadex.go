@@ -4,18 +4,33 @@ import (
 	"context"
 	"fmt"
 	"godex/internal/mangadex"
+	"godex/internal/util"
 	"os"
 	"path/filepath"
-	"strconv"
+	"sync"
 
 	"github.com/go-resty/resty/v2"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
 	downloadEndpoint = "https://api.mangadex.org/at-home/server/%v"
+	// maxPageAttempts is how many times a page is tried, possibly on different MangaDex@Home nodes.
+	maxPageAttempts = 3
 )
 
-type Mangadex struct{}
+type Mangadex struct {
+	// Quality is the preferred quality of the downloaded pages.
+	Quality mangadex.ImageQuality
+	// Validation is how thoroughly downloaded pages are decoded to check them.
+	Validation mangadex.PageValidation
+	reports    sync.WaitGroup
+}
+
+// Name identifies the source in the library.
+func (m *Mangadex) Name() string {
+	return "mangadex"
+}
 
 // IsValid is a function that checks if a given chapter is valid.
 // It checks if the ExternalURL attribute of the chapter is nil.
@@ -27,64 +42,105 @@ func (m *Mangadex) IsValid(chapter *mangadex.Chapter) bool {
 
 // DownloadChapterImages is a function that downloads images for a given chapter.
 // It first fetches the chapter data from the server using the provided HTTP client.
-// Then it iterates over each image in the chapter data and downloads it.
-// If an error occurs during the download, it cancels the context, which stops any ongoing downloads.
-// This function returns an error if it fails to fetch the chapter data or if an error occurs during the download.
-func (m *Mangadex) DownloadChapterImages(ctx context.Context, httpClient *resty.Client, chapterDir string, chapter *mangadex.Chapter) error {
-	endpoint := fmt.Sprintf(downloadEndpoint, chapter.ID)
-	chapterData := &mangadex.MDHomeServerResponse{}
-	_, err := httpClient.R().SetContext(ctx).SetResult(chapterData).Get(endpoint)
+// Then it downloads every image in the chapter data concurrently, in the preferred quality.
+// Failing pages, including the ones that are incomplete, corrupt or not images at all, are retried,
+// on a new MangaDex@Home node if the current one keeps failing.
+// If a page still can't be downloaded, the remaining downloads are cancelled.
+// This function returns the quality of the chapter, which is data-saver as soon as one page had to fall back to it,
+// and an error if it fails to fetch the chapter data or if any page failed to download.
+func (m *Mangadex) DownloadChapterImages(ctx context.Context, httpClient *resty.Client, chapterDir string, chapter *mangadex.Chapter) (mangadex.ImageQuality, error) {
+	server, err := newAtHomeServer(ctx, httpClient, chapter.ID)
 	if err != nil {
-		return fmt.Errorf("error getting chapter list: %w", err)
+		return "", err
 	}
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(10) // limit to 10 concurrent downloads
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	semaphore := make(chan struct{}, 10) // limit to 10 concurrent downloads
-
-	for i, imageData := range chapterData.Chapter.Data {
-		semaphore <- struct{}{} // acquire a token
-
-		url := fmt.Sprintf("%v/data/%v/%v", chapterData.BaseURL, chapterData.Chapter.Hash, imageData)
-		dataSaverUrl := fmt.Sprintf("%v/data-saver/%v/%v", chapterData.BaseURL, chapterData.Chapter.Hash, chapterData.Chapter.DataSaver[i])
-		go func(i int, url, dataSaverUrl string) {
-			defer func() { <-semaphore }() // release the token
-
-			if err := m.downloadImage(ctx, httpClient, chapterDir, url, dataSaverUrl, i); err != nil {
-				cancel() // cancel the context on error
+	pages := server.current().Chapter.Data
+	qualities := make([]mangadex.ImageQuality, len(pages))
+	for i := range pages {
+		page := i
+		g.Go(func() error {
+			quality, err := m.downloadPage(gCtx, httpClient, server, chapterDir, page)
+			if err != nil {
+				return fmt.Errorf("error downloading page %d: %w", page, err)
 			}
-		}(i, url, dataSaverUrl)
+			qualities[page] = quality
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return "", err
 	}
 
-	// wait for all downloads to finish
-	for i := 0; i < cap(semaphore); i++ {
-		semaphore <- struct{}{}
+	for _, quality := range qualities {
+		if quality == mangadex.QualityDataSaver {
+			return mangadex.QualityDataSaver, nil
+		}
 	}
-	return nil
+	return mangadex.QualityData, nil
+}
+
+// Wait blocks until the reports of every image fetched so far are sent to MangaDex@Home.
+// Reports are sent in the background, so the downloads aren't slowed down by them, and waited for once the run is over.
+func (m *Mangadex) Wait() {
+	m.reports.Wait()
+}
+
+// downloadPage downloads a single page from the current MangaDex@Home node.
+// Every failure is counted against the node so it gets replaced when it fails repeatedly.
+// It returns the quality the page was downloaded in.
+func (m *Mangadex) downloadPage(ctx context.Context, httpClient *resty.Client, server *atHomeServer, chapterDir string, page int) (mangadex.ImageQuality, error) {
+	var err error
+	for attempt := 0; attempt < maxPageAttempts; attempt++ {
+		chapterData := server.current()
+		var quality mangadex.ImageQuality
+		quality, err = m.downloadImage(ctx, httpClient, chapterDir, chapterData, page)
+		if err == nil || ctx.Err() != nil {
+			return quality, err
+		}
+		if refreshErr := server.failed(ctx, chapterData); refreshErr != nil {
+			return "", fmt.Errorf("%w (%v)", err, refreshErr)
+		}
+	}
+	return "", err
 }
 
 // downloadImage is a helper function that downloads a single image.
-// It first attempts to download the image at the provided URL.
-// If the download fails, it removes the partially downloaded file and then attempts to download the dataSaver version of the image.
-// This function returns an error if it fails to download either version of the image.
-func (m *Mangadex) downloadImage(ctx context.Context, httpClient *resty.Client, chapterDir, url, dataSaverUrl string, page int) error {
-	filePath := chapterDir + "/" + strconv.Itoa(page) + filepath.Ext(url)
-	_, err := httpClient.R().
-		SetContext(ctx).
-		SetOutput(filePath).
-		Get(url)
-	if err == nil {
-		return nil
+// Unless the data-saver quality is preferred, it first attempts to download the image in its original quality.
+// If that download fails, it removes the partially downloaded file and then attempts to download the dataSaver version of the image.
+// This function returns the quality of the downloaded image, or an error if it fails to download either version of the image.
+func (m *Mangadex) downloadImage(ctx context.Context, httpClient *resty.Client, chapterDir string, chapterData *mangadex.MDHomeServerResponse, page int) (mangadex.ImageQuality, error) {
+	if m.Quality != mangadex.QualityDataSaver {
+		url := pageUrl(chapterData, mangadex.QualityData, page)
+		filePath := filepath.Join(chapterDir, util.PageFileName(page, filepath.Ext(url)))
+		err := m.fetch(ctx, httpClient, url, filePath)
+		if err == nil {
+			return mangadex.QualityData, nil
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
+		// if we can't download the full quality image, just download the dataSaver version
+		err = os.Remove(filePath)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
 	}
-	// if we can't download the full quality image, just download the dataSaver version
-	err = os.Remove(filePath)
+	dataSaverUrl := pageUrl(chapterData, mangadex.QualityDataSaver, page)
+	filePath := filepath.Join(chapterDir, util.PageFileName(page, filepath.Ext(dataSaverUrl)))
+	err := m.fetch(ctx, httpClient, dataSaverUrl, filePath)
 	if err != nil {
-		return err
+		return "", err
+	}
+	return mangadex.QualityDataSaver, nil
+}
+
+// pageUrl builds the URL of a page in the given quality on the chapter's MangaDex@Home node.
+func pageUrl(chapterData *mangadex.MDHomeServerResponse, quality mangadex.ImageQuality, page int) string {
+	filename := chapterData.Chapter.Data[page]
+	if quality == mangadex.QualityDataSaver {
+		filename = chapterData.Chapter.DataSaver[page]
 	}
-	_, err = httpClient.R().
-		SetContext(ctx).
-		SetOutput(filePath).
-		Get(url)
-	return err
+	return fmt.Sprintf("%v/%v/%v/%v", chapterData.BaseURL, quality, chapterData.Chapter.Hash, filename)
 }
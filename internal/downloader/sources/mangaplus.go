@@ -6,14 +6,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"godex/internal/mangadex"
+	"godex/internal/util"
 	"io"
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/go-resty/resty/v2"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
@@ -43,7 +46,17 @@ type Page struct {
 }
 
 // Based on the implementation taken from https://github.com/tachiyomiorg/tachiyomi-extensions mostly for de-DRMing the images.
-type MangaPlus struct{}
+type MangaPlus struct {
+	// Quality is the quality of the downloaded pages, data-saver maps to MangaPlus' high quality instead of super high.
+	Quality mangadex.ImageQuality
+	// Validation is how thoroughly downloaded pages are decoded to check them.
+	Validation mangadex.PageValidation
+}
+
+// Name identifies the source in the library.
+func (p *MangaPlus) Name() string {
+	return "mangaplus"
+}
 
 // IsValid checks if the provided URL is valid for mangaplus.
 func (p *MangaPlus) IsValid(chapter *mangadex.Chapter) bool {
@@ -52,15 +65,27 @@ func (p *MangaPlus) IsValid(chapter *mangadex.Chapter) bool {
 }
 
 // DownloadChapterImages downloads all images of a chapter and saves them in a directory.
-// It returns the path to the directory where the images are saved.
-func (p *MangaPlus) DownloadChapterImages(ctx context.Context, httpClient *resty.Client, chapterDir string, chapter *mangadex.Chapter) error {
+// It returns the quality the images were downloaded in.
+func (p *MangaPlus) DownloadChapterImages(ctx context.Context, httpClient *resty.Client, chapterDir string, chapter *mangadex.Chapter) (mangadex.ImageQuality, error) {
 	externalUrl := chapter.Attributes.ExternalURL
 	chapterId := getChapterId(*externalUrl)
-	pages, err := getPageList(ctx, httpClient, chapterId)
+	quality := mangadex.QualityData
+	if p.Quality == mangadex.QualityDataSaver {
+		quality = mangadex.QualityDataSaver
+	}
+	pages, err := getPageList(ctx, httpClient, chapterId, quality)
 	if err != nil {
-		return err
+		return "", err
+	}
+	return quality, downloadImages(ctx, chapterDir, pages, p.Validation)
+}
+
+// imageQualityParam maps an image quality to the MangaPlus img_quality parameter.
+func imageQualityParam(quality mangadex.ImageQuality) string {
+	if quality == mangadex.QualityDataSaver {
+		return "high"
 	}
-	return downloadImages(ctx, chapterDir, pages)
+	return "super_high"
 }
 
 // getChapterId extracts the chapter ID from the chapter's external URL.
@@ -69,7 +94,7 @@ func getChapterId(chapter string) string {
 }
 
 // getPageList fetches the list of pages for a chapter.
-func getPageList(ctx context.Context, httpClient *resty.Client, chapterId string) ([]Page, error) {
+func getPageList(ctx context.Context, httpClient *resty.Client, chapterId string, quality mangadex.ImageQuality) ([]Page, error) {
 	headers := map[string]string{
 		"Referer":    API_URL + "/viewer/" + chapterId,
 		"User-Agent": USER_AGENT,
@@ -78,62 +103,83 @@ func getPageList(ctx context.Context, httpClient *resty.Client, chapterId string
 	queryParams := map[string]string{
 		"chapter_id":  chapterId,
 		"split":       "yes",
-		"img_quality": "super_high",
+		"img_quality": imageQualityParam(quality),
 		"format":      "json",
 	}
 	resp, err := httpClient.R().SetContext(ctx).
 		SetHeaders(headers).
 		SetQueryParams(queryParams).
 		Get(API_URL + "/manga_viewer")
-	if err != nil {
-		return nil, fmt.Errorf("cannot get chapter info from mangaplus: %v", err)
+	if err := mangadex.CheckResponse(resp, err); err != nil {
+		return nil, fmt.Errorf("cannot get chapter info from mangaplus: %w", err)
 	}
 	pages, err := pageListParse(resp)
 	if err != nil {
 		return nil, fmt.Errorf("cannot parse chapter info from mangaplus: %v", err)
 	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("mangaplus returned no pages for chapter %v", chapterId)
+	}
 	return pages, nil
 }
 
 // downloadImages downloads all images of a chapter concurrently using goroutines.
-func downloadImages(ctx context.Context, chapterDir string, pages []Page) error {
+// Every page is tried up to maxPageAttempts times, so pages that fail validation are downloaded again.
+// If any page still fails, the remaining downloads are cancelled and the error is returned.
+func downloadImages(ctx context.Context, chapterDir string, pages []Page, validation mangadex.PageValidation) error {
 	client := &http.Client{}
-	sem := make(chan struct{}, 10) // Limit the number of concurrent downloads to 10.
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(10) // Limit the number of concurrent downloads to 10.
 	for i, page := range pages {
 		if page.ImageUrl == "" {
 			continue
 		}
-		sem <- struct{}{} // Acquire a token.
-		go func(i int, page Page) {
-			defer func() { <-sem }() // Release the token when done.
-			req := imageRequest(page)
-			resp, err := client.Do(req)
+		i, page := i, page
+		g.Go(func() error {
+			var err error
+			for attempt := 0; attempt < maxPageAttempts; attempt++ {
+				err = downloadImage(gCtx, client, chapterDir, i, page, validation)
+				if err == nil || gCtx.Err() != nil {
+					break
+				}
+			}
 			if err != nil {
-				// Handle error.
-				return
+				return fmt.Errorf("error downloading page %d: %w", i, err)
 			}
-			defer resp.Body.Close()
+			return nil
+		})
+	}
+	return g.Wait()
+}
 
-			resp = imageIntercept(resp)
+// downloadImage downloads a single page, decrypting it if needed, and writes it in the chapter directory once validated.
+// The page is named .jpg whatever its format, pages are renamed after their actual format before they are archived.
+func downloadImage(ctx context.Context, client *http.Client, chapterDir string, i int, page Page, validation mangadex.PageValidation) error {
+	req, err := imageRequest(ctx, page)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
 
-			imgData, err := io.ReadAll(resp.Body)
-			if err != nil {
-				// Handle error.
-				return
-			}
+	resp = imageIntercept(resp)
 
-			err = os.WriteFile(fmt.Sprintf("%s/%d.jpg", chapterDir, i), imgData, 0644)
-			if err != nil {
-				// Handle error.
-				return
-			}
-		}(i, page)
+	imgData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
 	}
-	// Wait for all goroutines to finish.
-	for i := 0; i < cap(sem); i++ {
-		sem <- struct{}{}
+	// Decrypting keeps the size of the page, so it still matches the announced length
+	if err := validatePage(imgData, resp.ContentLength, "", validation); err != nil {
+		return err
 	}
-	return nil
+
+	return os.WriteFile(filepath.Join(chapterDir, util.PageFileName(i, ".jpg")), imgData, 0644)
 }
 
 // pageListParse parses the response from the MangaPlus API.
@@ -163,10 +209,13 @@ func pageListParse(response *resty.Response) ([]Page, error) {
 }
 
 // imageRequest creates a new HTTP request to download an image.
-func imageRequest(page Page) *http.Request {
-	req, _ := http.NewRequest("GET", page.ImageUrl, nil)
+func imageRequest(ctx context.Context, page Page) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", page.ImageUrl, nil)
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Set("Referer", page.Referer)
-	return req
+	return req, nil
 }
 
 // imageIntercept intercepts the HTTP response to decode the image if necessary.
@@ -8,14 +8,21 @@ import (
 )
 
 type Source interface {
+	// Name identifies the source in the library.
+	Name() string
 	// IsValid checks if the provided URL is valid for an external source.
 	IsValid(chapter *mangadex.Chapter) bool
 	// DownloadChapterImages downloads all images of a chapter and saves them in a directory.
-	// It returns the path to the directory where the images are saved.
+	// It returns the quality the images were downloaded in.
 	DownloadChapterImages(
 		ctx context.Context,
 		httpClient *resty.Client,
 		chapterDir string,
 		chapter *mangadex.Chapter,
-	) error
+	) (mangadex.ImageQuality, error)
+}
+
+// Waiter is implemented by the sources doing work in the background, which must be waited for before exiting.
+type Waiter interface {
+	Wait()
 }
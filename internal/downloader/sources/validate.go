@@ -0,0 +1,45 @@
+package sources
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"godex/internal/imaging"
+	"godex/internal/mangadex"
+	"path"
+	"strings"
+)
+
+// validatePage checks a downloaded page before it is archived: it has the size the server announced, if any,
+// it matches the SHA-256 hash MangaDex puts in page file names when there is one, and it decodes as an image.
+func validatePage(content []byte, contentLength int64, hash string, validation mangadex.PageValidation) error {
+	if contentLength >= 0 && int64(len(content)) != contentLength {
+		return fmt.Errorf("incomplete page: got %d bytes out of %d", len(content), contentLength)
+	}
+	if hash != "" {
+		sum := sha256.Sum256(content)
+		if actual := hex.EncodeToString(sum[:]); actual != hash {
+			return fmt.Errorf("corrupt page: SHA-256 is %v instead of %v", actual, hash)
+		}
+	}
+	if err := imaging.Validate(content, validation == mangadex.ValidateFull); err != nil {
+		return fmt.Errorf("invalid page: %w", err)
+	}
+	return nil
+}
+
+// pageHash returns the SHA-256 hash of a page taken from its MangaDex file name, such as 1-<hash>.png,
+// or an empty string if the name doesn't hold one.
+func pageHash(pageUrl string) string {
+	name := strings.TrimSuffix(path.Base(pageUrl), path.Ext(pageUrl))
+	if i := strings.LastIndex(name, "-"); i != -1 {
+		name = name[i+1:]
+	}
+	if len(name) != sha256.Size*2 {
+		return ""
+	}
+	if _, err := hex.DecodeString(name); err != nil {
+		return ""
+	}
+	return strings.ToLower(name)
+}
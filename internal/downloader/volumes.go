@@ -0,0 +1,302 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"godex/internal/archive"
+	"godex/internal/comicinfo"
+	"godex/internal/library"
+	"godex/internal/mangadex"
+	"godex/internal/naming"
+	"godex/internal/util"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// packVolumes packs every complete volume of a manga into a single archive, replacing the archives of its chapters.
+// The volumes of the chapters are refreshed from MangaDex first, since volumes are usually assigned after chapters are released.
+// Chapters stay in their own archives until their volume is complete, and volumes are repacked when chapters of theirs are downloaded later on.
+func (d *Downloader) packVolumes(ctx context.Context, mangadexClient *mangadex.Client, manga *mangadex.Manga, languages []string, folder string) error {
+	aggregate, err := mangadexClient.GetMangaAggregate(ctx, manga.ID)
+	if err != nil {
+		return err
+	}
+	if err := d.library.RefreshChapterVolumes(ctx, manga.ID, chapterVolumes(aggregate)); err != nil {
+		return err
+	}
+	volumes, err := d.library.UnpackagedVolumes(ctx, manga.ID)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, volume := range volumes {
+		complete, err := d.volumeComplete(ctx, manga, aggregate, volume)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !complete {
+			continue
+		}
+		if err := d.packVolume(ctx, manga, languages, folder, volume); err != nil {
+			errs = append(errs, fmt.Errorf("failed to pack volume %v: %w", volume, err))
+			continue
+		}
+		log.Printf("Packed volume: %v", volume)
+	}
+	return errors.Join(errs...)
+}
+
+// chapterVolumes returns the volume of every release listed in the aggregate of a manga, empty for the chapters without a volume.
+func chapterVolumes(aggregate *mangadex.MangaAggregate) map[string]string {
+	volumes := make(map[string]string)
+	for key, volume := range aggregate.Volumes {
+		if key == mangadex.AggregateNone {
+			key = ""
+		}
+		for _, chapter := range volume.Chapters {
+			for _, id := range chapter.IDs() {
+				volumes[id] = key
+			}
+		}
+	}
+	return volumes
+}
+
+// volumeComplete checks if a volume is out and every chapter MangaDex lists in it is downloaded, in any release.
+// A volume is out when it isn't after the last volume of the manga, or when MangaDex lists a later volume.
+func (d *Downloader) volumeComplete(ctx context.Context, manga *mangadex.Manga, aggregate *mangadex.MangaAggregate, volume string) (bool, error) {
+	listed, ok := aggregate.Volumes[volume]
+	if !ok || len(listed.Chapters) == 0 {
+		return false, nil
+	}
+	for number, chapter := range listed.Chapters {
+		downloaded, err := d.releaseDownloaded(ctx, manga.ID, number, chapter)
+		if err != nil || !downloaded {
+			return false, err
+		}
+	}
+
+	current, err := strconv.ParseFloat(volume, 64)
+	if err != nil {
+		// Volumes that aren't numbers can't be ordered
+		return false, nil
+	}
+	if lastVolume := manga.Attributes.LastVolume; lastVolume != nil {
+		if last, err := strconv.ParseFloat(*lastVolume, 64); err == nil && current <= last {
+			return true, nil
+		}
+	}
+	for key := range aggregate.Volumes {
+		if later, err := strconv.ParseFloat(key, 64); err == nil && later > current {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// releaseDownloaded checks if any release of a chapter number listed in the aggregate of a manga was downloaded.
+func (d *Downloader) releaseDownloaded(ctx context.Context, mangaID string, number string, chapter *mangadex.AggregateChapter) (bool, error) {
+	for _, id := range chapter.IDs() {
+		download, err := d.library.ChapterDownload(ctx, id)
+		if err != nil || download != nil {
+			return download != nil, err
+		}
+	}
+	if number == mangadex.AggregateNone {
+		return false, nil
+	}
+	download, err := d.library.FindDownload(ctx, mangaID, number)
+	return download != nil, err
+}
+
+// packVolume extracts the pages of the chapters of a volume, in chapter order, into a single archive.
+// When the volume was packed before, the pages of the chapters already in it are taken from its archive.
+// The volume is recorded in the library and the chapter archives are removed once it is written.
+func (d *Downloader) packVolume(ctx context.Context, manga *mangadex.Manga, languages []string, folder string, volume string) error {
+	downloads, chapters, err := d.volumeChapters(ctx, manga.ID, volume)
+	if err != nil {
+		return err
+	}
+	packed, err := d.library.Volume(ctx, manga.ID, volume)
+	if err != nil {
+		return err
+	}
+	writer, err := d.writer(manga.ID)
+	if err != nil {
+		return err
+	}
+	archivePath, err := d.volumeArchivePath(manga, languages, folder, volume, chapters, writer.Extension())
+	if err != nil {
+		return err
+	}
+
+	pagesDir, err := os.MkdirTemp(d.cfg.DownloadPath, ".volume-")
+	if err != nil {
+		return fmt.Errorf("error creating volume directory: %w", err)
+	}
+	defer os.RemoveAll(pagesDir)
+
+	var packedPages []string
+	if packed != nil {
+		packedDir, err := os.MkdirTemp(d.cfg.DownloadPath, ".volume-")
+		if err != nil {
+			return fmt.Errorf("error creating volume directory: %w", err)
+		}
+		defer os.RemoveAll(packedDir)
+		packedPages, err = extractVolume(packed, downloads, packedDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	sections := make([]archive.Section, len(downloads))
+	page := 0
+	for i, download := range downloads {
+		sections[i] = archive.Section{Title: chapters[i].Label(), FirstPage: page}
+		var pages int
+		if packed != nil && download.Path == packed.Path {
+			pages, err = movePages(packedPages[:download.Pages], pagesDir, page)
+			packedPages = packedPages[download.Pages:]
+		} else {
+			pages, err = archive.ExtractPages(download.Path, pagesDir, page)
+		}
+		if err != nil {
+			return err
+		}
+		download.Pages = pages
+		page += pages
+	}
+	book, err := volumeBook(manga, volume, chapters, languages, pagesDir)
+	if err != nil {
+		return err
+	}
+	book.Sections = sections
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0755); err != nil {
+		return fmt.Errorf("error creating directory for %v: %w", archivePath, err)
+	}
+	pages, err := writer.Write(pagesDir, archivePath, book)
+	if err != nil {
+		return err
+	}
+	hash, err := util.HashFile(archivePath)
+	if err != nil {
+		return fmt.Errorf("error hashing %v: %w", archivePath, err)
+	}
+
+	removed := map[string]bool{archivePath: true}
+	err = d.library.RecordVolume(ctx, &library.Volume{
+		MangaID:    manga.ID,
+		Volume:     volume,
+		Pages:      pages,
+		Path:       archivePath,
+		Hash:       hash,
+		PackagedAt: time.Now(),
+	}, downloads)
+	if err != nil {
+		return err
+	}
+
+	for _, download := range downloads {
+		if removed[download.Path] {
+			continue
+		}
+		removed[download.Path] = true
+		if err := os.Remove(download.Path); err != nil {
+			log.Printf("Could not remove chapter archive %v: %v", download.Path, err)
+			continue
+		}
+		// Fails on purpose when the directory still holds other files
+		_ = os.Remove(filepath.Dir(download.Path))
+	}
+	return nil
+}
+
+// extractVolume extracts the pages of a packed volume into a directory, returning their paths in reading order.
+// The chapters of the volume hold as many pages as their downloads tell, in chapter order, which is checked against the archive.
+func extractVolume(packed *library.Volume, downloads []*library.Download, dir string) ([]string, error) {
+	count, err := archive.ExtractPages(packed.Path, dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	expected := 0
+	for _, download := range downloads {
+		if download.Path == packed.Path {
+			expected += download.Pages
+		}
+	}
+	if expected != count {
+		return nil, fmt.Errorf("cannot repack volume %v, its chapters hold %v pages but %v has %v", packed.Volume, expected, packed.Path, count)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading volume directory: %w", err)
+	}
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = filepath.Join(dir, file.Name())
+	}
+	return paths, nil
+}
+
+// movePages moves page images into a directory, numbering them from firstPage on like extracted pages.
+// It returns the number of moved pages.
+func movePages(paths []string, dir string, firstPage int) (int, error) {
+	for i, path := range paths {
+		if err := os.Rename(path, filepath.Join(dir, fmt.Sprintf("%04d%s", firstPage+i, filepath.Ext(path)))); err != nil {
+			return 0, fmt.Errorf("error moving page %v: %w", path, err)
+		}
+	}
+	return len(paths), nil
+}
+
+// volumeBook describes a volume to its archive, along with its ComicInfo document.
+func volumeBook(manga *mangadex.Manga, volume string, chapters []*mangadex.Chapter, languages []string, pagesDir string) (*archive.Book, error) {
+	info, err := comicinfo.NewVolume(manga, volume, chapters, languages, pagesDir)
+	if err != nil {
+		return nil, err
+	}
+	return &archive.Book{
+		ID:          fmt.Sprintf("urn:mangadex:%v:volume:%v", manga.ID, volume),
+		Title:       info.Series + " - " + info.Title,
+		Series:      info.Series,
+		Language:    info.LanguageISO,
+		Description: info.Summary,
+		RightToLeft: info.RightToLeft(),
+		ComicInfo:   info,
+	}, nil
+}
+
+// volumeChapters returns the downloads of the chapters of a volume along with the chapters themselves, in chapter order.
+func (d *Downloader) volumeChapters(ctx context.Context, mangaID string, volume string) ([]*library.Download, []*mangadex.Chapter, error) {
+	downloads, err := d.library.VolumeDownloads(ctx, mangaID, volume)
+	if err != nil {
+		return nil, nil, err
+	}
+	chapters := make([]*mangadex.Chapter, 0, len(downloads))
+	for _, download := range downloads {
+		chapter, _, err := d.library.Chapter(ctx, download.ChapterID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if chapter == nil {
+			return nil, nil, fmt.Errorf("chapter %v is missing from the library", download.ChapterID)
+		}
+		chapters = append(chapters, chapter)
+	}
+	return downloads, chapters, nil
+}
+
+// volumeArchivePath returns the path of the archive of a volume according to the volume path template.
+func (d *Downloader) volumeArchivePath(manga *mangadex.Manga, languages []string, folder string, volume string, chapters []*mangadex.Chapter, extension string) (string, error) {
+	fields := naming.NewVolumeFields(folder, manga.Title(languages), manga.ID, volume, chapters)
+	volumePath, err := d.volumeTemplate.Path(fields, d.cfg.Filenames)
+	if err != nil {
+		return "", err
+	}
+	return util.ChapterArchivePath(d.cfg.DownloadPath, volumePath, extension), nil
+}
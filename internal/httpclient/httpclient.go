@@ -0,0 +1,90 @@
+package httpclient
+
+import (
+	"context"
+	"godex/internal/mangadex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	retryWaitTime    = time.Second
+	retryMaxWaitTime = time.Minute
+)
+
+// noRetryKey marks the contexts of requests that must not be retried by the client.
+type noRetryKey struct{}
+
+// New creates the resty client shared by the MangaDex client and the download sources.
+// Requests to MangaDex hosts are throttled to stay under the API rate limits, and idempotent requests failing
+// with a transport error, a 429 or a 5xx are retried with an exponential backoff.
+func New(cfg *mangadex.Config) *resty.Client {
+	limiter := NewLimiter(cfg.RateLimit, cfg.AtHomeRateLimit)
+	return resty.New().
+		OnBeforeRequest(limiter.Wait).
+		SetRetryCount(cfg.MaxRetries).
+		SetRetryWaitTime(retryWaitTime).
+		SetRetryMaxWaitTime(retryMaxWaitTime).
+		AddRetryCondition(shouldRetry).
+		SetRetryAfter(retryAfter)
+}
+
+// WithoutRetries returns a context whose requests are never retried by the client,
+// for callers that already retry them their own way, like page downloads.
+func WithoutRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+// shouldRetry retries transport errors, rate limited requests and server errors of idempotent requests.
+// Other requests, like logins and reports, may have been processed already and are only retried when rate limited,
+// as the server refused them outright.
+func shouldRetry(resp *resty.Response, err error) bool {
+	if resp == nil || resp.Request == nil {
+		return false
+	}
+	if noRetry, _ := resp.Request.Context().Value(noRetryKey{}).(bool); noRetry {
+		return false
+	}
+	if err == nil && resp.StatusCode() == http.StatusTooManyRequests {
+		return true
+	}
+	if !idempotent(resp.Request.Method) {
+		return false
+	}
+	return err != nil || resp.StatusCode() >= http.StatusInternalServerError
+}
+
+// idempotent tells if requests of the method can be sent again without changing their outcome.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryAfter honors the wait time asked by the server, either through MangaDex's X-RateLimit-Retry-After
+// unix timestamp or through a standard Retry-After header.
+// Returning 0 lets resty fall back to its exponential backoff.
+func retryAfter(_ *resty.Client, resp *resty.Response) (time.Duration, error) {
+	var wait time.Duration
+	if value := resp.Header().Get("X-RateLimit-Retry-After"); value != "" {
+		if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
+			wait = time.Until(time.Unix(timestamp, 0))
+		}
+	} else if value := resp.Header().Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			wait = time.Duration(seconds) * time.Second
+		} else if date, err := http.ParseTime(value); err == nil {
+			wait = time.Until(date)
+		}
+	}
+	if wait < 0 {
+		return 0, nil
+	}
+	return wait, nil
+}
@@ -0,0 +1,78 @@
+package httpclient
+
+import (
+	"math"
+	"net/url"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+	"golang.org/x/time/rate"
+)
+
+const (
+	apiHost        = "api.mangadex.org"
+	authHost       = "auth.mangadex.org"
+	atHomeEndpoint = "/at-home/server/"
+)
+
+// pathLimit : A stricter limit applied on top of the host limit for a specific endpoint.
+type pathLimit struct {
+	host    string
+	prefix  string
+	limiter *rate.Limiter
+}
+
+// Limiter throttles requests per host, with stricter limits for some endpoints.
+// Hosts without a limit, like the image servers, are not throttled.
+type Limiter struct {
+	hosts map[string]*rate.Limiter
+	paths []pathLimit
+}
+
+// NewLimiter creates a limiter allowing requestsPerSecond on each MangaDex API host
+// and atHomePerMinute on the at-home server endpoint.
+func NewLimiter(requestsPerSecond float64, atHomePerMinute float64) *Limiter {
+	return &Limiter{
+		hosts: map[string]*rate.Limiter{
+			apiHost:  newRateLimiter(requestsPerSecond),
+			authHost: newRateLimiter(requestsPerSecond),
+		},
+		paths: []pathLimit{
+			{
+				host:    apiHost,
+				prefix:  atHomeEndpoint,
+				limiter: newRateLimiter(atHomePerMinute / 60),
+			},
+		},
+	}
+}
+
+// newRateLimiter creates a token bucket refilling at the given rate per second.
+// A rate of zero or less disables the limit.
+func newRateLimiter(perSecond float64) *rate.Limiter {
+	if perSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), int(math.Max(1, math.Floor(perSecond))))
+}
+
+// Wait blocks until the request is allowed by the limits of its host and endpoint.
+// It's meant to be registered as a resty OnBeforeRequest middleware, so retries are throttled as well.
+func (l *Limiter) Wait(_ *resty.Client, req *resty.Request) error {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		// Let resty report the invalid URL
+		return nil
+	}
+	for _, path := range l.paths {
+		if u.Host == path.host && strings.HasPrefix(u.Path, path.prefix) {
+			if err := path.limiter.Wait(req.Context()); err != nil {
+				return err
+			}
+		}
+	}
+	if limiter, ok := l.hosts[u.Host]; ok {
+		return limiter.Wait(req.Context())
+	}
+	return nil
+}
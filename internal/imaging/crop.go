@@ -0,0 +1,139 @@
+package imaging
+
+import (
+	"fmt"
+	"godex/internal/mangadex"
+	"image"
+	"math"
+)
+
+// Default border cropping settings, used unless configured otherwise.
+const (
+	DefaultCropTolerance  = 0.005
+	DefaultCropThreshold  = 40
+	DefaultCropMaxPercent = 10
+)
+
+const (
+	// pageNumberHeight is the largest share of the page height a page number standing alone in a border takes.
+	pageNumberHeight = 0.04
+	// pageNumberGap is the smallest share of the page height between a page number and the content of the page.
+	pageNumberGap = 0.005
+)
+
+// validateCrop fills in the border cropping settings left unset and checks them.
+func validateCrop(crop mangadex.CropConfig) (mangadex.CropConfig, error) {
+	if crop.Threshold == 0 {
+		crop.Threshold = DefaultCropThreshold
+	}
+	if crop.MaxPercent == 0 {
+		crop.MaxPercent = DefaultCropMaxPercent
+	}
+	switch {
+	case crop.Tolerance < 0 || crop.Tolerance >= 1:
+		return crop, fmt.Errorf("invalid crop tolerance %v, expected a number from 0 to 1", crop.Tolerance)
+	case crop.Threshold < 0 || crop.Threshold > 255:
+		return crop, fmt.Errorf("invalid crop threshold %v, expected a number from 0 to 255", crop.Threshold)
+	case crop.MaxPercent < 0 || crop.MaxPercent >= 50:
+		return crop, fmt.Errorf("invalid crop percentage %v, expected a number from 0 to 50", crop.MaxPercent)
+	}
+	return crop, nil
+}
+
+// cropBorders trims the uniform borders of a page, up to the largest share of its size allowed on each side.
+// Borders are detected on gray levels: a line belongs to the border while almost all its pixels are close to the color of the outermost line.
+func (p *Pipeline) cropBorders(img image.Image) image.Image {
+	gray := toGray(img)
+	width, height := gray.Bounds().Dx(), gray.Bounds().Dy()
+	maxX := int(float64(width) * p.Crop.MaxPercent / 100)
+	maxY := int(float64(height) * p.Crop.MaxPercent / 100)
+	row := func(y int) []uint8 {
+		return gray.Pix[y*gray.Stride : y*gray.Stride+width]
+	}
+	column := func(x int) []uint8 {
+		levels := make([]uint8, height)
+		for y := range levels {
+			levels[y] = gray.Pix[y*gray.Stride+x]
+		}
+		return levels
+	}
+
+	top := p.border(maxY, height, row, p.Crop.PageNumbers)
+	bottom := p.border(maxY, height, func(i int) []uint8 { return row(height - 1 - i) }, p.Crop.PageNumbers)
+	left := p.border(maxX, width, column, false)
+	right := p.border(maxX, width, func(i int) []uint8 { return column(width - 1 - i) }, false)
+	if top+bottom+left+right == 0 {
+		return img
+	}
+	bounds := img.Bounds()
+	return crop(img, image.Rect(bounds.Min.X+left, bounds.Min.Y+top, bounds.Max.X-right, bounds.Max.Y-bottom))
+}
+
+// border returns how many lines from a side of a page belong to its border, at most limit.
+// line returns the levels of the i-th line from the side, size is the page size across the lines.
+// With pageNumbers, a thin band of content followed by more border is taken as a page number and cropped too.
+func (p *Pipeline) border(limit int, size int, line func(i int) []uint8, pageNumbers bool) int {
+	if limit <= 0 {
+		return 0
+	}
+	background, ok := p.borderLevel(line(0))
+	if !ok {
+		return 0
+	}
+	blank := func(i int) bool {
+		return p.isBorder(line(i), background)
+	}
+	edge := 0
+	for edge < limit && blank(edge) {
+		edge++
+	}
+	if !pageNumbers || edge == limit {
+		return edge
+	}
+
+	maxBand := int(math.Ceil(float64(size) * pageNumberHeight))
+	minGap := int(math.Max(2, float64(size)*pageNumberGap))
+	band := edge
+	for band < limit && band-edge <= maxBand && !blank(band) {
+		band++
+	}
+	gap := band
+	for gap < limit && blank(gap) {
+		gap++
+	}
+	if band > edge && band-edge <= maxBand && gap-band >= minGap {
+		return gap
+	}
+	return edge
+}
+
+// borderLevel returns the most common level of the outermost line of a side, and whether the line is uniform enough to be a border.
+func (p *Pipeline) borderLevel(levels []uint8) (uint8, bool) {
+	var histogram [256]int
+	for _, level := range levels {
+		histogram[level]++
+	}
+	background := 0
+	for level, count := range histogram {
+		if count > histogram[background] {
+			background = level
+		}
+	}
+	return uint8(background), p.isBorder(levels, uint8(background))
+}
+
+// isBorder tells if a line is part of the border: few enough of its pixels are further than the threshold from the border level.
+func (p *Pipeline) isBorder(levels []uint8, background uint8) bool {
+	allowed := int(float64(len(levels)) * p.Crop.Tolerance)
+	outliers := 0
+	for _, level := range levels {
+		diff := int(level) - int(background)
+		if diff > p.Crop.Threshold || -diff > p.Crop.Threshold {
+			outliers++
+			if outliers > allowed {
+				return false
+			}
+		}
+	}
+	return true
+}
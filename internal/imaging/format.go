@@ -0,0 +1,201 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// transcodeQuality is the JPEG quality lossy pages are converted in, high enough not to add visible artifacts.
+const transcodeQuality = 95
+
+// Format : The actual format of an image, as told by its first bytes.
+type Format string
+
+// The formats pages come in. FormatUnknown is the format of anything that isn't a known image, such as an error page.
+const (
+	FormatUnknown Format = ""
+	FormatJPEG    Format = "jpeg"
+	FormatPNG     Format = "png"
+	FormatGIF     Format = "gif"
+	FormatWebP    Format = "webp"
+	FormatAVIF    Format = "avif"
+)
+
+// Extension returns the file extension of the format, dot included.
+func (f Format) Extension() string {
+	switch f {
+	case FormatJPEG:
+		return ".jpg"
+	case FormatUnknown:
+		return ""
+	default:
+		return "." + string(f)
+	}
+}
+
+// Decodable tells if images of the format can be decoded, and so processed or converted.
+// There is no AVIF decoder written in Go.
+func (f Format) Decodable() bool {
+	switch f {
+	case FormatJPEG, FormatPNG, FormatGIF, FormatWebP:
+		return true
+	default:
+		return false
+	}
+}
+
+// Sniff tells the format of an image from its first bytes. The first 32 bytes are enough to tell every format apart.
+func Sniff(header []byte) Format {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xff, 0xd8, 0xff}):
+		return FormatJPEG
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return FormatGIF
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WEBP":
+		return FormatWebP
+	case len(header) >= 12 && string(header[4:8]) == "ftyp" && (string(header[8:12]) == "avif" || string(header[8:12]) == "avis"):
+		return FormatAVIF
+	default:
+		return FormatUnknown
+	}
+}
+
+// sniffFile reads the first bytes of an image file and tells its format, along with whether it is a lossless WebP image.
+func sniffFile(path string) (Format, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return FormatUnknown, false, err
+	}
+	defer file.Close()
+	header := make([]byte, 32)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return FormatUnknown, false, err
+	}
+	header = header[:n]
+	format := Sniff(header)
+	return format, format == FormatWebP && webpLossless(header), nil
+}
+
+// webpLossless tells if a WebP image is lossless or has an alpha channel, so it is better converted to PNG than to JPEG.
+func webpLossless(header []byte) bool {
+	if len(header) < 21 {
+		return false
+	}
+	switch string(header[12:16]) {
+	case "VP8L":
+		return true
+	case "VP8X":
+		// The extended format flags the images having an alpha channel
+		return header[20]&0x10 != 0
+	default:
+		return false
+	}
+}
+
+// NormalizePages gives every page image of a directory the extension of its actual format, whatever the source named it.
+// With transcode, the formats e-readers and comic readers don't handle well are converted:
+// lossy WebP images to JPEG, and GIF and lossless WebP images to PNG.
+// AVIF images are left as they are since there is no AVIF decoder written in Go.
+func NormalizePages(dir string, transcode bool) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		if err := normalizePage(path, transcode); err != nil {
+			return fmt.Errorf("failed to normalize %v: %w", file.Name(), err)
+		}
+	}
+	return nil
+}
+
+// UndecodablePages returns the names of the page images of a directory in a known format that can't be decoded, such as AVIF.
+func UndecodablePages(dir string) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	var names []string
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		format, _, err := sniffFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if format != FormatUnknown && !format.Decodable() {
+			names = append(names, file.Name())
+		}
+	}
+	return names, nil
+}
+
+// normalizePage renames a page image after its actual format, converting it first if needed.
+// Images of an unknown format are left as they are.
+func normalizePage(path string, transcode bool) error {
+	format, lossless, err := sniffFile(path)
+	if err != nil || format == FormatUnknown {
+		return err
+	}
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	if transcode {
+		switch {
+		case format == FormatAVIF:
+			log.Printf("Keeping AVIF page %v as it is, it can't be converted", filepath.Base(path))
+		case format == FormatGIF, format == FormatWebP && lossless:
+			return convert(path, base+FormatPNG.Extension(), encodePNG)
+		case format == FormatWebP:
+			return convert(path, base+FormatJPEG.Extension(), func(target string, img image.Image) error {
+				return encodeJPEG(target, img, transcodeQuality)
+			})
+		}
+	}
+	target := base + format.Extension()
+	if target == path {
+		return nil
+	}
+	return os.Rename(path, target)
+}
+
+// convert decodes an image and encodes it at target, removing the original image.
+func convert(path string, target string, encode func(string, image.Image) error) error {
+	img, err := decode(path)
+	if err != nil {
+		return err
+	}
+	if err := encode(target, img); err != nil {
+		return err
+	}
+	if target == path {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// encodePNG writes an image as a PNG.
+func encodePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to encode image: %w", err)
+	}
+	return file.Close()
+}
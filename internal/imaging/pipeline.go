@@ -0,0 +1,293 @@
+package imaging
+
+import (
+	"fmt"
+	"godex/internal/mangadex"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultQuality is the JPEG quality processed pages are encoded in unless configured otherwise.
+const DefaultQuality = 85
+
+// Pipeline : Processes the page images of a chapter for an e-reader, in pure Go.
+type Pipeline struct {
+	// Width and Height bound the size of the pages, 0 leaving the dimension unbounded.
+	Width     int
+	Height    int
+	Grayscale bool
+	Gamma     float64
+	Contrast  float64
+	Quality   int
+	// Spreads is how pages wider than they are high are shown.
+	Spreads mangadex.SpreadMode
+	// RightToLeft is true for manga read from right to left, whose spreads start with their right half.
+	RightToLeft bool
+	// Crop trims the uniform borders of pages when enabled.
+	Crop mangadex.CropConfig
+	// levels maps every gray or color level to its value after gamma and contrast correction, nil when they leave levels unchanged.
+	levels *[256]uint8
+}
+
+// New builds the pipeline described by the configuration, for a manga read in the given direction.
+// It returns nil if no profile is configured, pages are then archived as downloaded.
+func New(cfg mangadex.ProcessingConfig, rightToLeft bool) (*Pipeline, error) {
+	if cfg.Profile == "" {
+		return nil, nil
+	}
+	profile, err := LookupProfile(cfg.Profile)
+	if err != nil {
+		return nil, err
+	}
+	p := &Pipeline{
+		Width:       profile.Width,
+		Height:      profile.Height,
+		Grayscale:   profile.Grayscale,
+		Gamma:       cfg.Gamma,
+		Contrast:    cfg.Contrast,
+		Quality:     cfg.Quality,
+		Spreads:     profile.Spreads,
+		RightToLeft: rightToLeft,
+	}
+	if cfg.Width != 0 {
+		p.Width = cfg.Width
+	}
+	if cfg.Height != 0 {
+		p.Height = cfg.Height
+	}
+	if cfg.Grayscale != nil {
+		p.Grayscale = *cfg.Grayscale
+	}
+	if cfg.Spreads != "" {
+		if p.Spreads, err = mangadex.ParseSpreadMode(string(cfg.Spreads)); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Crop.Enabled {
+		if p.Crop, err = validateCrop(cfg.Crop); err != nil {
+			return nil, err
+		}
+	}
+	if p.Gamma == 0 {
+		p.Gamma = 1
+	}
+	if p.Contrast == 0 {
+		p.Contrast = 1
+	}
+	if p.Quality == 0 {
+		p.Quality = DefaultQuality
+	}
+
+	switch {
+	case p.Width < 0 || p.Height < 0:
+		return nil, fmt.Errorf("invalid page size %vx%v", p.Width, p.Height)
+	case p.Gamma < 0:
+		return nil, fmt.Errorf("invalid gamma %v, expected a positive number", p.Gamma)
+	case p.Contrast < 0:
+		return nil, fmt.Errorf("invalid contrast %v, expected a positive number", p.Contrast)
+	case p.Quality < 1 || p.Quality > 100:
+		return nil, fmt.Errorf("invalid JPEG quality %v, expected a number from 1 to 100", p.Quality)
+	}
+	if p.Gamma != 1 || p.Contrast != 1 {
+		p.levels = levels(p.Gamma, p.Contrast)
+	}
+	return p, nil
+}
+
+// levels computes the value of every level after the contrast is scaled around the middle gray and the gamma applied.
+func levels(gamma float64, contrast float64) *[256]uint8 {
+	var table [256]uint8
+	for i := range table {
+		value := (float64(i)/255-0.5)*contrast + 0.5
+		value = math.Pow(math.Max(0, math.Min(1, value)), gamma)
+		table[i] = uint8(math.Round(value * 255))
+	}
+	return &table
+}
+
+// ProcessDir processes every page image of a directory in place, several pages at a time.
+// Processed pages are encoded in JPEG and replace the downloaded images.
+// Pages in a format that can't be decoded, such as AVIF, are left as they are.
+func (p *Pipeline) ProcessDir(dir string) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+	var g errgroup.Group
+	g.SetLimit(runtime.NumCPU())
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		g.Go(func() error {
+			if err := p.processPage(path); err != nil {
+				return fmt.Errorf("failed to process %v: %w", filepath.Base(path), err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// processPage decodes a page image, processes it and writes it back as a JPEG with the same name.
+// Spreads turned into several pages are written with a suffix numbering them in reading order.
+func (p *Pipeline) processPage(path string) error {
+	format, _, err := sniffFile(path)
+	if err != nil {
+		return err
+	}
+	if format != FormatUnknown && !format.Decodable() {
+		log.Printf("Keeping %v page %v as it is, it can't be processed", strings.ToUpper(string(format)), filepath.Base(path))
+		return nil
+	}
+	img, err := decode(path)
+	if err != nil {
+		return err
+	}
+	pages := p.process(img)
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	written := false
+	for i, page := range pages {
+		target := base + ".jpg"
+		if len(pages) > 1 {
+			target = fmt.Sprintf("%v-%d.jpg", base, i+1)
+		}
+		if err := encodeJPEG(target, page, p.Quality); err != nil {
+			return err
+		}
+		written = written || target == path
+	}
+	if !written {
+		return os.Remove(path)
+	}
+	return nil
+}
+
+// process converts, crops, lays out, scales and corrects the levels of an image, returning the pages it is shown as.
+// Pages are converted to gray levels first so they are processed on a single channel,
+// and cropped before spreads are split so the halves are cut in the middle of the content.
+func (p *Pipeline) process(img image.Image) []image.Image {
+	if p.Grayscale {
+		img = toGray(img)
+	}
+	if p.Crop.Enabled {
+		img = p.cropBorders(img)
+	}
+	pages := p.spread(img)
+	for i, page := range pages {
+		page = p.resize(page)
+		if p.levels != nil {
+			page = applyLevels(page, p.levels)
+		}
+		pages[i] = page
+	}
+	return pages
+}
+
+// resize scales an image down to fit in the page size, keeping its aspect ratio. Smaller images are left as they are.
+func (p *Pipeline) resize(img image.Image) image.Image {
+	bounds := img.Bounds()
+	scale := 1.0
+	if p.Width > 0 && bounds.Dx() > p.Width {
+		scale = float64(p.Width) / float64(bounds.Dx())
+	}
+	if p.Height > 0 && bounds.Dy() > p.Height {
+		scale = math.Min(scale, float64(p.Height)/float64(bounds.Dy()))
+	}
+	if scale == 1 {
+		return img
+	}
+	width := math.Max(1, math.Round(float64(bounds.Dx())*scale))
+	height := math.Max(1, math.Round(float64(bounds.Dy())*scale))
+	rect := image.Rect(0, 0, int(width), int(height))
+	var scaled draw.Image
+	if _, ok := img.(*image.Gray); ok {
+		scaled = image.NewGray(rect)
+	} else {
+		scaled = image.NewRGBA(rect)
+	}
+	draw.CatmullRom.Scale(scaled, rect, img, bounds, draw.Src, nil)
+	return scaled
+}
+
+// toGray converts an image to gray levels, transparent areas turning white.
+func toGray(img image.Image) *image.Gray {
+	if gray, ok := img.(*image.Gray); ok {
+		return gray
+	}
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(gray, gray.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(gray, gray.Bounds(), img, bounds.Min, draw.Over)
+	return gray
+}
+
+// applyLevels maps every level of an image through the table, on the gray or color channels.
+func applyLevels(img image.Image, table *[256]uint8) image.Image {
+	switch img := img.(type) {
+	case *image.Gray:
+		for i, v := range img.Pix {
+			img.Pix[i] = table[v]
+		}
+		return img
+	case *image.RGBA:
+		for i, v := range img.Pix {
+			if i%4 != 3 {
+				img.Pix[i] = table[v]
+			}
+		}
+		return img
+	default:
+		return applyLevels(toRGBA(img), table)
+	}
+}
+
+// decode reads a page image in any of the supported formats.
+func decode(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
+
+// encodeJPEG writes an image as a JPEG. Transparent areas end up black, as JPEG has no alpha channel,
+// so they are drawn over white first.
+func encodeJPEG(path string, img image.Image, quality int) error {
+	if _, ok := img.(*image.Gray); !ok {
+		if opaque, ok := img.(interface{ Opaque() bool }); !ok || !opaque.Opaque() {
+			bounds := img.Bounds()
+			flat := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+			draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+			draw.Draw(flat, flat.Bounds(), img, bounds.Min, draw.Over)
+			img = flat
+		}
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(file, img, &jpeg.Options{Quality: quality}); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to encode image: %w", err)
+	}
+	return file.Close()
+}
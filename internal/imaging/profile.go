@@ -0,0 +1,61 @@
+package imaging
+
+import (
+	"fmt"
+	"godex/internal/mangadex"
+	"sort"
+	"strings"
+)
+
+// CustomProfile is the profile whose screen size is entirely given by the configuration.
+const CustomProfile = "custom"
+
+// Profile : The screen of an e-reader.
+type Profile struct {
+	Width  int
+	Height int
+	// Grayscale is true for e-ink screens without colors.
+	Grayscale bool
+	// Spreads is how double-page spreads are best shown on the screen.
+	Spreads mangadex.SpreadMode
+}
+
+// profiles are the screens of the supported e-readers, keyed by profile name.
+// Spreads are split on the smaller screens and rotated on the ones large enough to show them turned.
+var profiles = map[string]Profile{
+	CustomProfile:         {Spreads: mangadex.SpreadKeep},
+	"kobo-clara-hd":       {Width: 1072, Height: 1448, Grayscale: true, Spreads: mangadex.SpreadSplit},
+	"kobo-clara-2e":       {Width: 1072, Height: 1448, Grayscale: true, Spreads: mangadex.SpreadSplit},
+	"kobo-clara-bw":       {Width: 1072, Height: 1448, Grayscale: true, Spreads: mangadex.SpreadSplit},
+	"kobo-clara-colour":   {Width: 1072, Height: 1448, Spreads: mangadex.SpreadSplit},
+	"kobo-libra-h2o":      {Width: 1264, Height: 1680, Grayscale: true, Spreads: mangadex.SpreadSplit},
+	"kobo-libra-2":        {Width: 1264, Height: 1680, Grayscale: true, Spreads: mangadex.SpreadSplit},
+	"kobo-libra-colour":   {Width: 1264, Height: 1680, Spreads: mangadex.SpreadSplit},
+	"kobo-forma":          {Width: 1440, Height: 1920, Grayscale: true, Spreads: mangadex.SpreadRotate},
+	"kobo-sage":           {Width: 1440, Height: 1920, Grayscale: true, Spreads: mangadex.SpreadRotate},
+	"kobo-elipsa":         {Width: 1404, Height: 1872, Grayscale: true, Spreads: mangadex.SpreadRotate},
+	"kindle-paperwhite":   {Width: 1072, Height: 1448, Grayscale: true, Spreads: mangadex.SpreadSplit},
+	"kindle-paperwhite-5": {Width: 1236, Height: 1648, Grayscale: true, Spreads: mangadex.SpreadSplit},
+	"kindle-oasis":        {Width: 1264, Height: 1680, Grayscale: true, Spreads: mangadex.SpreadSplit},
+	"kindle-scribe":       {Width: 1860, Height: 2480, Grayscale: true, Spreads: mangadex.SpreadRotate},
+	"kindle-colorsoft":    {Width: 1264, Height: 1680, Spreads: mangadex.SpreadSplit},
+}
+
+// LookupProfile returns the profile of an e-reader by name.
+func LookupProfile(name string) (Profile, error) {
+	profile, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown device profile %q, expected one of %v", name, strings.Join(ProfileNames(), ", "))
+	}
+	return profile, nil
+}
+
+// ProfileNames returns the names of every profile, sorted.
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
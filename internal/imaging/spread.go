@@ -0,0 +1,97 @@
+package imaging
+
+import (
+	"godex/internal/mangadex"
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// spread lays out a page according to the spread mode, in reading order.
+// Only pages wider than they are high are spreads, the other pages are returned as they are.
+func (p *Pipeline) spread(img image.Image) []image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= bounds.Dy() {
+		return []image.Image{img}
+	}
+	switch p.Spreads {
+	case mangadex.SpreadSplit:
+		return p.split(img)
+	case mangadex.SpreadRotate:
+		return []image.Image{p.rotate(img)}
+	case mangadex.SpreadBoth:
+		return append([]image.Image{p.rotate(img)}, p.split(img)...)
+	default:
+		return []image.Image{img}
+	}
+}
+
+// split cuts a spread in its two halves, the right one first for manga read from right to left.
+func (p *Pipeline) split(img image.Image) []image.Image {
+	bounds := img.Bounds()
+	middle := bounds.Min.X + bounds.Dx()/2
+	left := crop(img, image.Rect(bounds.Min.X, bounds.Min.Y, middle, bounds.Max.Y))
+	right := crop(img, image.Rect(middle, bounds.Min.Y, bounds.Max.X, bounds.Max.Y))
+	if p.RightToLeft {
+		return []image.Image{right, left}
+	}
+	return []image.Image{left, right}
+}
+
+// rotate turns a spread a quarter so the half read first ends up on top:
+// counterclockwise for manga read from right to left, clockwise otherwise.
+func (p *Pipeline) rotate(img image.Image) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	// target returns where the pixel at x, y of the spread goes in the rotated page
+	target := func(x, y int) (int, int) {
+		if p.RightToLeft {
+			return y, width - 1 - x
+		}
+		return height - 1 - y, x
+	}
+	rect := image.Rect(0, 0, height, width)
+	if gray, ok := img.(*image.Gray); ok {
+		rotated := image.NewGray(rect)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				tx, ty := target(x, y)
+				rotated.Pix[ty*rotated.Stride+tx] = gray.Pix[gray.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)]
+			}
+		}
+		return rotated
+	}
+	rgba := toRGBA(img)
+	rotated := image.NewRGBA(rect)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			tx, ty := target(x, y)
+			copy(rotated.Pix[ty*rotated.Stride+tx*4:ty*rotated.Stride+tx*4+4], rgba.Pix[y*rgba.Stride+x*4:y*rgba.Stride+x*4+4])
+		}
+	}
+	return rotated
+}
+
+// crop copies a part of an image into a new image, so it doesn't share its pixels with the original one.
+func crop(img image.Image, rect image.Rectangle) image.Image {
+	bounds := image.Rect(0, 0, rect.Dx(), rect.Dy())
+	if _, ok := img.(*image.Gray); ok {
+		cropped := image.NewGray(bounds)
+		draw.Draw(cropped, bounds, img, rect.Min, draw.Src)
+		return cropped
+	}
+	cropped := image.NewRGBA(bounds)
+	draw.Draw(cropped, bounds, img, rect.Min, draw.Src)
+	return cropped
+}
+
+// toRGBA returns an image as RGBA, with its origin at 0, 0.
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	if rgba, ok := img.(*image.RGBA); ok && bounds.Min == (image.Point{}) {
+		return rgba
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
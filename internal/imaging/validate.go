@@ -0,0 +1,30 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+)
+
+// Validate checks that content is an image readers can show: its format is known and its header decodes,
+// or, with full, the whole image decodes. AVIF images are only checked by their signature since they can't be decoded in Go.
+func Validate(content []byte, full bool) error {
+	format := Sniff(content)
+	switch format {
+	case FormatUnknown:
+		return errors.New("not an image")
+	case FormatAVIF:
+		return nil
+	}
+	var err error
+	if full {
+		_, _, err = image.Decode(bytes.NewReader(content))
+	} else {
+		_, _, err = image.DecodeConfig(bytes.NewReader(content))
+	}
+	if err != nil {
+		return fmt.Errorf("corrupt %v image: %w", format, err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const lastSyncedAtKey = "last_synced_at"
+
+// migrations are applied in order, the index of the last applied one is kept in the user_version pragma.
+var migrations = []string{
+	`CREATE TABLE manga (
+		id TEXT PRIMARY KEY,
+		title TEXT NOT NULL,
+		original_language TEXT NOT NULL,
+		status TEXT,
+		content_rating TEXT,
+		year INTEGER,
+		last_volume TEXT,
+		last_chapter TEXT,
+		attributes TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+	CREATE TABLE chapters (
+		id TEXT PRIMARY KEY,
+		manga_id TEXT NOT NULL REFERENCES manga(id),
+		volume TEXT,
+		chapter TEXT,
+		title TEXT NOT NULL,
+		language TEXT NOT NULL,
+		external_url TEXT,
+		publish_at TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		attributes TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+	CREATE INDEX chapters_manga_id ON chapters(manga_id, chapter);
+	CREATE TABLE scanlation_groups (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL
+	);
+	CREATE TABLE chapter_groups (
+		chapter_id TEXT NOT NULL REFERENCES chapters(id),
+		group_id TEXT NOT NULL REFERENCES scanlation_groups(id),
+		PRIMARY KEY (chapter_id, group_id)
+	);
+	CREATE TABLE downloads (
+		chapter_id TEXT PRIMARY KEY REFERENCES chapters(id),
+		source TEXT NOT NULL,
+		quality TEXT NOT NULL,
+		pages INTEGER NOT NULL,
+		path TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		downloaded_at TEXT NOT NULL
+	);
+	CREATE TABLE sync_state (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);`,
+	`ALTER TABLE chapters ADD COLUMN sync_status TEXT NOT NULL DEFAULT 'pending';
+	ALTER TABLE chapters ADD COLUMN sync_error TEXT;
+	UPDATE chapters SET sync_status = 'done' WHERE id IN (SELECT chapter_id FROM downloads);
+	CREATE TABLE manga_sync (
+		manga_id TEXT PRIMARY KEY REFERENCES manga(id),
+		synced_at TEXT NOT NULL
+	);`,
+	`ALTER TABLE manga ADD COLUMN folder TEXT;
+	CREATE UNIQUE INDEX manga_folder ON manga(folder);`,
+	`CREATE TABLE volumes (
+		manga_id TEXT NOT NULL REFERENCES manga(id),
+		volume TEXT NOT NULL,
+		pages INTEGER NOT NULL,
+		path TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		packaged_at TEXT NOT NULL,
+		PRIMARY KEY (manga_id, volume)
+	);`,
+	// Localised strings were saved wrapped in a Values object before they were encoded the way MangaDex sends them
+	`UPDATE manga SET attributes = json_set(attributes, '$.title', json(COALESCE(json_extract(attributes, '$.title.Values'), '{}')))
+	WHERE json_type(attributes, '$.title.Values') IN ('object', 'null');
+	UPDATE manga SET attributes = json_set(attributes, '$.altTitles', json(COALESCE(json_extract(attributes, '$.altTitles.Values'), '{}')))
+	WHERE json_type(attributes, '$.altTitles.Values') IN ('object', 'null');
+	UPDATE manga SET attributes = json_set(attributes, '$.description', json(COALESCE(json_extract(attributes, '$.description.Values'), '{}')))
+	WHERE json_type(attributes, '$.description.Values') IN ('object', 'null');
+	UPDATE manga SET attributes = json_set(attributes, '$.links', json(COALESCE(json_extract(attributes, '$.links.Values'), '{}')))
+	WHERE json_type(attributes, '$.links.Values') IN ('object', 'null');`,
+	`ALTER TABLE chapters ADD COLUMN sync_attempts INTEGER NOT NULL DEFAULT 0;
+	UPDATE chapters SET sync_attempts = 1 WHERE sync_status = 'failed';`,
+}
+
+// Library : The local database of every manga, chapter and download godex knows about.
+type Library struct {
+	db *sql.DB
+}
+
+// Open opens the library database at the given path, creating it if needed, and brings its schema up to date.
+func Open(path string) (*Library, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating library directory: %w", err)
+	}
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("error opening library: %w", err)
+	}
+	// SQLite only allows a single writer, sharing one connection avoids busy errors
+	db.SetMaxOpenConns(1)
+
+	lib := &Library{db: db}
+	if err := lib.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return lib, nil
+}
+
+// Close closes the library database.
+func (l *Library) Close() error {
+	return l.db.Close()
+}
+
+// migrate applies the migrations that weren't applied to the database yet.
+func (l *Library) migrate() error {
+	var version int
+	if err := l.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("error reading library version: %w", err)
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := l.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error migrating library to version %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error migrating library to version %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LastSyncedAt returns when the followed manga feed was last synced.
+// The boolean is false when the feed was never synced.
+func (l *Library) LastSyncedAt(ctx context.Context) (time.Time, bool, error) {
+	var value string
+	err := l.db.QueryRowContext(ctx, "SELECT value FROM sync_state WHERE key = ?", lastSyncedAtKey).Scan(&value)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("error reading last sync date: %w", err)
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("error parsing last sync date: %w", err)
+	}
+	return t, true, nil
+}
+
+// SetLastSyncedAt saves when the followed manga feed was last synced.
+func (l *Library) SetLastSyncedAt(ctx context.Context, t time.Time) error {
+	_, err := l.db.ExecContext(ctx,
+		`INSERT INTO sync_state (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`,
+		lastSyncedAtKey, t.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("error saving last sync date: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"godex/internal/mangadex"
+)
+
+// Manga returns the manga with the given ID, or nil if it isn't in the library.
+func (l *Library) Manga(ctx context.Context, mangaID string) (*mangadex.Manga, error) {
+	var attributes string
+	err := l.db.QueryRowContext(ctx, "SELECT attributes FROM manga WHERE id = ?", mangaID).Scan(&attributes)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading manga %v: %w", mangaID, err)
+	}
+	manga := &mangadex.Manga{ID: mangaID, Type: "manga"}
+	if err := json.Unmarshal([]byte(attributes), &manga.Attributes); err != nil {
+		return nil, fmt.Errorf("error unmarshalling attributes of manga %v: %w", mangaID, err)
+	}
+	return manga, nil
+}
+
+// MangaByFolder returns the ID of the manga stored in the given folder, or whose title is the folder name.
+// Names are compared ignoring case. It returns an empty string when no manga matches.
+func (l *Library) MangaByFolder(ctx context.Context, folder string) (string, error) {
+	var mangaID string
+	err := l.db.QueryRowContext(ctx,
+		`SELECT id FROM manga
+		WHERE folder = ?1 COLLATE NOCASE OR title = ?1 COLLATE NOCASE
+		ORDER BY folder IS NULL
+		LIMIT 1`,
+		folder).Scan(&mangaID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("error finding manga in folder %v: %w", folder, err)
+	}
+	return mangaID, nil
+}
+
+// Chapter returns the chapter with the given ID along with its scanlation groups and the ID of its manga.
+// The chapter is nil if it isn't in the library.
+func (l *Library) Chapter(ctx context.Context, chapterID string) (*mangadex.Chapter, string, error) {
+	var mangaID, attributes string
+	err := l.db.QueryRowContext(ctx,
+		"SELECT manga_id, attributes FROM chapters WHERE id = ?",
+		chapterID).Scan(&mangaID, &attributes)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading chapter %v: %w", chapterID, err)
+	}
+	chapter := &mangadex.Chapter{ID: chapterID, Type: "chapter"}
+	if err := json.Unmarshal([]byte(attributes), &chapter.Attributes); err != nil {
+		return nil, "", fmt.Errorf("error unmarshalling attributes of chapter %v: %w", chapterID, err)
+	}
+
+	rows, err := l.db.QueryContext(ctx,
+		`SELECT g.id, g.name FROM chapter_groups cg
+		JOIN scanlation_groups g ON g.id = cg.group_id
+		WHERE cg.chapter_id = ?
+		ORDER BY g.rowid`,
+		chapterID)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading scanlation groups of chapter %v: %w", chapterID, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, "", err
+		}
+		chapter.Relationships = append(chapter.Relationships, mangadex.Relationship{
+			ID:         id,
+			Type:       "scanlation_group",
+			Attributes: &mangadex.ScanlationGroupAttributes{Name: name},
+		})
+	}
+	return chapter, mangaID, rows.Err()
+}
+
+// ChapterByNumber returns the ID of a chapter of the given manga with the given number.
+// Downloaded chapters come first, then the earliest published one. It returns an empty string when no chapter matches.
+func (l *Library) ChapterByNumber(ctx context.Context, mangaID string, chapterNumber string) (string, error) {
+	var chapterID string
+	err := l.db.QueryRowContext(ctx,
+		`SELECT c.id FROM chapters c
+		LEFT JOIN downloads d ON d.chapter_id = c.id
+		WHERE c.manga_id = ? AND c.chapter = ?
+		ORDER BY d.chapter_id IS NULL, c.publish_at, c.id
+		LIMIT 1`,
+		mangaID, chapterNumber).Scan(&chapterID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("error finding chapter %v: %w", chapterNumber, err)
+	}
+	return chapterID, nil
+}
+
+// DownloadByPath returns the download whose archive is at the given path, or nil if there is none.
+func (l *Library) DownloadByPath(ctx context.Context, path string) (*Download, error) {
+	row := l.db.QueryRowContext(ctx,
+		`SELECT chapter_id, source, quality, pages, path, hash, downloaded_at
+		FROM downloads
+		WHERE path = ?`,
+		path)
+	download, err := scanDownload(row)
+	if err != nil {
+		return nil, fmt.Errorf("error finding download at %v: %w", path, err)
+	}
+	return download, nil
+}
@@ -0,0 +1,236 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"godex/internal/mangadex"
+	"time"
+)
+
+// Download : A chapter archive saved in the download directory.
+type Download struct {
+	ChapterID    string
+	Source       string
+	Quality      mangadex.ImageQuality
+	Pages        int
+	Path         string
+	Hash         string
+	DownloadedAt time.Time
+}
+
+// SaveManga inserts or updates a manga.
+func (l *Library) SaveManga(ctx context.Context, manga *mangadex.Manga) error {
+	attributes, err := json.Marshal(manga.Attributes)
+	if err != nil {
+		return fmt.Errorf("error marshalling manga attributes: %w", err)
+	}
+	_, err = l.db.ExecContext(ctx,
+		`INSERT INTO manga (id, title, original_language, status, content_rating, year, last_volume, last_chapter, attributes, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			title = excluded.title,
+			original_language = excluded.original_language,
+			status = excluded.status,
+			content_rating = excluded.content_rating,
+			year = excluded.year,
+			last_volume = excluded.last_volume,
+			last_chapter = excluded.last_chapter,
+			attributes = excluded.attributes,
+			updated_at = excluded.updated_at`,
+		manga.ID,
+		manga.Title(nil),
+		manga.Attributes.OriginalLanguage,
+		manga.Attributes.Status,
+		manga.Attributes.ContentRating,
+		manga.Attributes.Year,
+		manga.Attributes.LastVolume,
+		manga.Attributes.LastChapter,
+		string(attributes),
+		time.Now().Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("error saving manga %v: %w", manga.ID, err)
+	}
+	return nil
+}
+
+// MangaFolder returns the name of the folder of a manga in the download directory, or an empty string if it has none yet.
+func (l *Library) MangaFolder(ctx context.Context, mangaID string) (string, error) {
+	var folder sql.NullString
+	err := l.db.QueryRowContext(ctx, "SELECT folder FROM manga WHERE id = ?", mangaID).Scan(&folder)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("error reading folder of manga %v: %w", mangaID, err)
+	}
+	return folder.String, nil
+}
+
+// SetMangaFolder saves the name of the folder of a manga in the download directory.
+func (l *Library) SetMangaFolder(ctx context.Context, mangaID string, folder string) error {
+	_, err := l.db.ExecContext(ctx, "UPDATE manga SET folder = ? WHERE id = ?", folder, mangaID)
+	if err != nil {
+		return fmt.Errorf("error saving folder of manga %v: %w", mangaID, err)
+	}
+	return nil
+}
+
+// FolderTaken checks if another manga already uses a folder name, ignoring case for case-insensitive file systems.
+func (l *Library) FolderTaken(ctx context.Context, folder string, mangaID string) (bool, error) {
+	var count int
+	err := l.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM manga WHERE folder = ? COLLATE NOCASE AND id != ?",
+		folder, mangaID).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("error checking folder %v: %w", folder, err)
+	}
+	return count > 0, nil
+}
+
+// SaveChapter inserts or updates a chapter of the given manga along with its scanlation groups.
+func (l *Library) SaveChapter(ctx context.Context, mangaID string, chapter *mangadex.Chapter) error {
+	attributes, err := json.Marshal(chapter.Attributes)
+	if err != nil {
+		return fmt.Errorf("error marshalling chapter attributes: %w", err)
+	}
+
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO chapters (id, manga_id, volume, chapter, title, language, external_url, publish_at, created_at, attributes, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			manga_id = excluded.manga_id,
+			volume = excluded.volume,
+			chapter = excluded.chapter,
+			title = excluded.title,
+			language = excluded.language,
+			external_url = excluded.external_url,
+			publish_at = excluded.publish_at,
+			created_at = excluded.created_at,
+			attributes = excluded.attributes,
+			updated_at = excluded.updated_at`,
+		chapter.ID,
+		mangaID,
+		chapter.Attributes.Volume,
+		chapter.Attributes.Chapter,
+		chapter.Attributes.Title,
+		chapter.Attributes.TranslatedLanguage,
+		chapter.Attributes.ExternalURL,
+		chapter.Attributes.PublishAt,
+		chapter.Attributes.CreatedAt,
+		string(attributes),
+		time.Now().Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("error saving chapter %v: %w", chapter.ID, err)
+	}
+
+	for _, group := range chapter.Groups() {
+		// Groups only come with a name when they were included in the response, keep the known one otherwise
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO scanlation_groups (id, name) VALUES (?, ?)
+			ON CONFLICT (id) DO UPDATE SET name = excluded.name WHERE excluded.name != ''`,
+			group.ID, group.Attributes.Name)
+		if err != nil {
+			return fmt.Errorf("error saving scanlation group %v: %w", group.ID, err)
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO chapter_groups (chapter_id, group_id) VALUES (?, ?)
+			ON CONFLICT DO NOTHING`,
+			chapter.ID, group.ID)
+		if err != nil {
+			return fmt.Errorf("error linking chapter %v to scanlation group %v: %w", chapter.ID, group.ID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RecordDownload saves the archive downloaded for a chapter, replacing any previous download of it.
+func (l *Library) RecordDownload(ctx context.Context, download *Download) error {
+	_, err := l.db.ExecContext(ctx,
+		`INSERT INTO downloads (chapter_id, source, quality, pages, path, hash, downloaded_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chapter_id) DO UPDATE SET
+			source = excluded.source,
+			quality = excluded.quality,
+			pages = excluded.pages,
+			path = excluded.path,
+			hash = excluded.hash,
+			downloaded_at = excluded.downloaded_at`,
+		download.ChapterID,
+		download.Source,
+		download.Quality,
+		download.Pages,
+		download.Path,
+		download.Hash,
+		download.DownloadedAt.Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("error saving download of chapter %v: %w", download.ChapterID, err)
+	}
+	return nil
+}
+
+// FindDownload returns the download of a chapter of the given manga with the given chapter number,
+// or nil if no such chapter was downloaded.
+func (l *Library) FindDownload(ctx context.Context, mangaID string, chapterNumber string) (*Download, error) {
+	row := l.db.QueryRowContext(ctx,
+		`SELECT d.chapter_id, d.source, d.quality, d.pages, d.path, d.hash, d.downloaded_at
+		FROM downloads d
+		JOIN chapters c ON c.id = d.chapter_id
+		WHERE c.manga_id = ? AND c.chapter = ?
+		ORDER BY d.downloaded_at DESC
+		LIMIT 1`,
+		mangaID, chapterNumber)
+	download, err := scanDownload(row)
+	if err != nil {
+		return nil, fmt.Errorf("error finding download of chapter %v: %w", chapterNumber, err)
+	}
+	return download, nil
+}
+
+// ChapterDownload returns the download of the chapter with the given ID, or nil if it wasn't downloaded.
+func (l *Library) ChapterDownload(ctx context.Context, chapterID string) (*Download, error) {
+	row := l.db.QueryRowContext(ctx,
+		`SELECT chapter_id, source, quality, pages, path, hash, downloaded_at
+		FROM downloads
+		WHERE chapter_id = ?`,
+		chapterID)
+	download, err := scanDownload(row)
+	if err != nil {
+		return nil, fmt.Errorf("error finding download of chapter %v: %w", chapterID, err)
+	}
+	return download, nil
+}
+
+// scanDownload reads a download out of a row, returning nil if there is no row.
+func scanDownload(row *sql.Row) (*Download, error) {
+	download := &Download{}
+	var downloadedAt string
+	err := row.Scan(
+		&download.ChapterID,
+		&download.Source,
+		&download.Quality,
+		&download.Pages,
+		&download.Path,
+		&download.Hash,
+		&downloadedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	download.DownloadedAt, err = time.Parse(time.RFC3339, downloadedAt)
+	if err != nil {
+		return nil, err
+	}
+	return download, nil
+}
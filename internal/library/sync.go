@@ -0,0 +1,150 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ChapterStatus : Where a chapter stands in the sync of its manga.
+type ChapterStatus string
+
+const (
+	// ChapterPending chapters were seen in a sync but not handled yet, for instance because godex was interrupted.
+	ChapterPending ChapterStatus = "pending"
+	// ChapterDone chapters are downloaded, they won't be fetched again.
+	ChapterDone ChapterStatus = "done"
+	// ChapterFailed chapters failed to download and are retried on the next sync.
+	ChapterFailed ChapterStatus = "failed"
+	// ChapterUnavailable chapters don't exist anymore on their source, or can't be downloaded at all, they aren't retried.
+	ChapterUnavailable ChapterStatus = "unavailable"
+	// ChapterAbandoned chapters failed too many times, or left the feed before they could be downloaded, they aren't retried.
+	ChapterAbandoned ChapterStatus = "abandoned"
+)
+
+// MaxChapterAttempts is how many syncs in a row a chapter can fail in before it is abandoned.
+const MaxChapterAttempts = 5
+
+// SetChapterStatus updates the sync status of a chapter, along with the error that made it fail if any.
+// Failed chapters are abandoned once they failed MaxChapterAttempts times in a row, so they don't hold the feed window back forever.
+func (l *Library) SetChapterStatus(ctx context.Context, chapterID string, status ChapterStatus, syncErr error) error {
+	var errMsg sql.NullString
+	if syncErr != nil {
+		errMsg = sql.NullString{String: syncErr.Error(), Valid: true}
+	}
+	_, err := l.db.ExecContext(ctx,
+		`UPDATE chapters SET
+			sync_status = CASE WHEN ?1 = ?2 AND sync_attempts + 1 >= ?3 THEN ?4 ELSE ?1 END,
+			sync_attempts = CASE WHEN ?1 = ?2 THEN sync_attempts + 1 ELSE 0 END,
+			sync_error = ?5
+		WHERE id = ?6`,
+		status, ChapterFailed, MaxChapterAttempts, ChapterAbandoned, errMsg, chapterID)
+	if err != nil {
+		return fmt.Errorf("error saving sync status of chapter %v: %w", chapterID, err)
+	}
+	return nil
+}
+
+// AbandonMissingChapters gives up on the outstanding chapters missing from a synced feed, given the IDs of the chapters it returned.
+// Those chapters were read on the site, removed, or belong to manga that aren't followed anymore, so no sync would retry them.
+// It returns how many chapters were abandoned.
+func (l *Library) AbandonMissingChapters(ctx context.Context, feedChapterIDs []string) (int, error) {
+	rows, err := l.db.QueryContext(ctx,
+		"SELECT id FROM chapters WHERE sync_status IN (?, ?)",
+		ChapterPending, ChapterFailed)
+	if err != nil {
+		return 0, fmt.Errorf("error listing outstanding chapters: %w", err)
+	}
+	var outstanding []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		outstanding = append(outstanding, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error listing outstanding chapters: %w", err)
+	}
+
+	inFeed := make(map[string]bool, len(feedChapterIDs))
+	for _, id := range feedChapterIDs {
+		inFeed[id] = true
+	}
+	abandoned := 0
+	for _, id := range outstanding {
+		if inFeed[id] {
+			continue
+		}
+		_, err := l.db.ExecContext(ctx,
+			"UPDATE chapters SET sync_status = ?, sync_error = COALESCE(sync_error, ?) WHERE id = ?",
+			ChapterAbandoned, "left the feed before it was downloaded", id)
+		if err != nil {
+			return abandoned, fmt.Errorf("error abandoning chapter %v: %w", id, err)
+		}
+		abandoned++
+	}
+	return abandoned, nil
+}
+
+// InitMangaCursors sets the sync cursor of the library's manga that don't have one yet.
+// A manga's cursor is the time up to which all of its chapters were handled.
+func (l *Library) InitMangaCursors(ctx context.Context, mangaIDs []string, t time.Time) error {
+	for _, mangaID := range mangaIDs {
+		_, err := l.db.ExecContext(ctx,
+			`INSERT INTO manga_sync (manga_id, synced_at)
+			SELECT id, ? FROM manga WHERE id = ?
+			ON CONFLICT (manga_id) DO NOTHING`,
+			t.UTC().Format(time.RFC3339), mangaID)
+		if err != nil {
+			return fmt.Errorf("error initializing sync cursor of manga %v: %w", mangaID, err)
+		}
+	}
+	return nil
+}
+
+// AdvanceMangaCursors moves the sync cursor of the given manga to t, unless they still have outstanding chapters.
+// Manga with failed or pending chapters keep their cursor so the next sync covers those chapters again.
+func (l *Library) AdvanceMangaCursors(ctx context.Context, mangaIDs []string, t time.Time) error {
+	for _, mangaID := range mangaIDs {
+		_, err := l.db.ExecContext(ctx,
+			`UPDATE manga_sync SET synced_at = ?
+			WHERE manga_id = ? AND NOT EXISTS (
+				SELECT 1 FROM chapters WHERE manga_id = manga_sync.manga_id AND sync_status IN (?, ?)
+			)`,
+			t.UTC().Format(time.RFC3339), mangaID, ChapterPending, ChapterFailed)
+		if err != nil {
+			return fmt.Errorf("error advancing sync cursor of manga %v: %w", mangaID, err)
+		}
+	}
+	return nil
+}
+
+// SyncWindowStart returns the date the followed manga feed should be queried from.
+// That's the feed cursor, unless a manga with outstanding chapters has an older cursor.
+func (l *Library) SyncWindowStart(ctx context.Context, feedCursor time.Time) (time.Time, error) {
+	var oldest sql.NullString
+	err := l.db.QueryRowContext(ctx,
+		`SELECT MIN(synced_at) FROM manga_sync
+		WHERE EXISTS (
+			SELECT 1 FROM chapters WHERE manga_id = manga_sync.manga_id AND sync_status IN (?, ?)
+		)`,
+		ChapterPending, ChapterFailed).Scan(&oldest)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error computing sync window: %w", err)
+	}
+	if !oldest.Valid {
+		return feedCursor, nil
+	}
+	cursor, err := time.Parse(time.RFC3339, oldest.String)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error parsing sync cursor: %w", err)
+	}
+	if cursor.Before(feedCursor) {
+		return cursor, nil
+	}
+	return feedCursor, nil
+}
@@ -0,0 +1,194 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Volume : The archive packing every chapter of a volume.
+type Volume struct {
+	MangaID    string
+	Volume     string
+	Pages      int
+	Path       string
+	Hash       string
+	PackagedAt time.Time
+}
+
+// UnpackagedVolumes lists the volumes of a manga with downloaded chapters that weren't packed yet, in ascending order.
+// Packed volumes are listed again when chapters of theirs were downloaded since, so they get repacked with them.
+func (l *Library) UnpackagedVolumes(ctx context.Context, mangaID string) ([]string, error) {
+	rows, err := l.db.QueryContext(ctx,
+		`SELECT DISTINCT c.volume FROM chapters c
+		JOIN downloads d ON d.chapter_id = c.id
+		LEFT JOIN volumes v ON v.manga_id = c.manga_id AND v.volume = c.volume
+		WHERE c.manga_id = ? AND c.volume IS NOT NULL AND c.volume != ''
+		AND (v.path IS NULL OR d.path != v.path)
+		ORDER BY CAST(c.volume AS REAL)`,
+		mangaID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing volumes of manga %v: %w", mangaID, err)
+	}
+	defer rows.Close()
+	var volumes []string
+	for rows.Next() {
+		var volume string
+		if err := rows.Scan(&volume); err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, volume)
+	}
+	return volumes, rows.Err()
+}
+
+// RefreshChapterVolumes updates the volume of the chapters of a manga, given the volume of every chapter ID, empty for chapters without one.
+// MangaDex usually assigns volumes after the chapters are released, so volumes change after the chapters are downloaded.
+// Chapters already packed into a volume archive stay in their volume.
+func (l *Library) RefreshChapterVolumes(ctx context.Context, mangaID string, volumes map[string]string) error {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for chapterID, volume := range volumes {
+		value := sql.NullString{String: volume, Valid: volume != ""}
+		_, err := tx.ExecContext(ctx,
+			`UPDATE chapters SET volume = ?1, attributes = json_set(attributes, '$.volume', ?1)
+			WHERE id = ?2 AND manga_id = ?3 AND volume IS NOT ?1
+			AND NOT EXISTS (SELECT 1 FROM downloads d JOIN volumes v ON v.path = d.path WHERE d.chapter_id = chapters.id)`,
+			value, chapterID, mangaID)
+		if err != nil {
+			return fmt.Errorf("error updating volume of chapter %v: %w", chapterID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// VolumeDownloads returns the downloads of the chapters of a volume, in chapter order.
+func (l *Library) VolumeDownloads(ctx context.Context, mangaID string, volume string) ([]*Download, error) {
+	rows, err := l.db.QueryContext(ctx,
+		`SELECT d.chapter_id, d.source, d.quality, d.pages, d.path, d.hash, d.downloaded_at
+		FROM downloads d
+		JOIN chapters c ON c.id = d.chapter_id
+		WHERE c.manga_id = ? AND c.volume = ?
+		ORDER BY CAST(c.chapter AS REAL), c.publish_at`,
+		mangaID, volume)
+	if err != nil {
+		return nil, fmt.Errorf("error listing downloads of volume %v: %w", volume, err)
+	}
+	defer rows.Close()
+	var downloads []*Download
+	for rows.Next() {
+		download := &Download{}
+		var downloadedAt string
+		err := rows.Scan(&download.ChapterID, &download.Source, &download.Quality, &download.Pages, &download.Path, &download.Hash, &downloadedAt)
+		if err != nil {
+			return nil, err
+		}
+		download.DownloadedAt, err = time.Parse(time.RFC3339, downloadedAt)
+		if err != nil {
+			return nil, err
+		}
+		downloads = append(downloads, download)
+	}
+	return downloads, rows.Err()
+}
+
+// RecordVolume saves the archive of a volume and points the downloads of its chapters to it.
+// The page count of every download is updated to the number of pages the chapter has in the volume,
+// so the pages of each chapter can be told apart when the volume is repacked.
+func (l *Library) RecordVolume(ctx context.Context, volume *Volume, downloads []*Download) error {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO volumes (manga_id, volume, pages, path, hash, packaged_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (manga_id, volume) DO UPDATE SET
+			pages = excluded.pages,
+			path = excluded.path,
+			hash = excluded.hash,
+			packaged_at = excluded.packaged_at`,
+		volume.MangaID,
+		volume.Volume,
+		volume.Pages,
+		volume.Path,
+		volume.Hash,
+		volume.PackagedAt.Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("error saving volume %v: %w", volume.Volume, err)
+	}
+	for _, download := range downloads {
+		_, err = tx.ExecContext(ctx, "UPDATE downloads SET path = ?, pages = ? WHERE chapter_id = ?", volume.Path, download.Pages, download.ChapterID)
+		if err != nil {
+			return fmt.Errorf("error moving chapter %v to volume %v: %w", download.ChapterID, volume.Volume, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Volume returns the archive of a volume of a manga, or nil if the volume wasn't packed.
+func (l *Library) Volume(ctx context.Context, mangaID string, volume string) (*Volume, error) {
+	row := l.db.QueryRowContext(ctx,
+		`SELECT manga_id, volume, pages, path, hash, packaged_at FROM volumes WHERE manga_id = ? AND volume = ?`,
+		mangaID, volume)
+	packed, err := scanVolume(row)
+	if err != nil {
+		return nil, fmt.Errorf("error finding volume %v: %w", volume, err)
+	}
+	return packed, nil
+}
+
+// VolumeByPath returns the volume whose archive is at the given path, or nil if there is none.
+func (l *Library) VolumeByPath(ctx context.Context, path string) (*Volume, error) {
+	row := l.db.QueryRowContext(ctx,
+		`SELECT manga_id, volume, pages, path, hash, packaged_at FROM volumes WHERE path = ?`,
+		path)
+	volume, err := scanVolume(row)
+	if err != nil {
+		return nil, fmt.Errorf("error finding volume at %v: %w", path, err)
+	}
+	return volume, nil
+}
+
+// scanVolume reads a volume out of a row, returning nil if there is no row.
+func scanVolume(row *sql.Row) (*Volume, error) {
+	volume := &Volume{}
+	var packagedAt string
+	err := row.Scan(&volume.MangaID, &volume.Volume, &volume.Pages, &volume.Path, &volume.Hash, &packagedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	volume.PackagedAt, err = time.Parse(time.RFC3339, packagedAt)
+	if err != nil {
+		return nil, err
+	}
+	return volume, nil
+}
+
+// MoveArchive updates the path of an archive for the downloads and the volume it holds.
+func (l *Library) MoveArchive(ctx context.Context, from string, to string) error {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE downloads SET path = ? WHERE path = ?", to, from); err != nil {
+		return fmt.Errorf("error moving downloads of %v: %w", from, err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE volumes SET path = ? WHERE path = ?", to, from); err != nil {
+		return fmt.Errorf("error moving volume of %v: %w", from, err)
+	}
+	return tx.Commit()
+}
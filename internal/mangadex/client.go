@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-resty/resty/v2"
@@ -15,59 +16,48 @@ import (
 )
 
 const (
-	loginEndpoint    = "https://auth.mangadex.org/realms/mangadex/protocol/openid-connect/token"
-	followedEndpoint = "https://api.mangadex.org/user/follows/manga/feed?translatedLanguage[]=en&includes[]=manga&order[readableAt]=desc&createdAtSince=%v"
-	getReadEndpoint  = "https://api.mangadex.org/manga/read/?ids[]=%v"
-	setReadEndpoint  = "https://api.mangadex.org/manga/%v/read"
-	chapterEndpoint  = "https://api.mangadex.org/chapter"
+	loginEndpoint     = "https://auth.mangadex.org/realms/mangadex/protocol/openid-connect/token"
+	followedEndpoint  = "https://api.mangadex.org/user/follows/manga/feed"
+	getReadEndpoint   = "https://api.mangadex.org/manga/read/?ids[]=%v"
+	setReadEndpoint   = "https://api.mangadex.org/manga/%v/read"
+	chapterEndpoint   = "https://api.mangadex.org/chapter"
+	mangaEndpoint     = "https://api.mangadex.org/manga"
+	aggregateEndpoint = "https://api.mangadex.org/manga/%v/aggregate"
+)
+
+const (
+	// feedPageLimit is the largest page size accepted by the feed endpoints.
+	feedPageLimit = 500
+	// maxFeedWindow is the ceiling MangaDex puts on offset + limit for list endpoints.
+	maxFeedWindow = 10000
 )
 
 type Client struct {
-	restyClient *resty.Client
-	cfg         *Config
-	authToken   string
+	restyClient  *resty.Client
+	cfg          *Config
+	sessionStore SessionStore
+	sessionMu    sync.Mutex
+	session      *Session
 }
 
-func NewClient(cfg *Config, restyClient *resty.Client) *Client {
+// NewClient creates a MangaDex client.
+// The session store is optional, when nil the client logs in with the password grant on every run.
+func NewClient(cfg *Config, restyClient *resty.Client, sessionStore SessionStore) *Client {
 	return &Client{
-		restyClient: restyClient,
-		cfg:         cfg,
-	}
-}
-
-func (c *Client) SetAuthToken(authToken string) {
-	c.authToken = authToken
-}
-
-// Login Tries to authenticate a user using the provided credentials
-func (c *Client) Login(ctx context.Context) (*LoginResponse, error) {
-	loginResult := &LoginResponse{}
-	_, err := c.restyClient.R().SetContext(ctx).SetResult(loginResult).
-		SetFormData(map[string]string{
-			"grant_type":    "password",
-			"username":      c.cfg.Username,
-			"password":      c.cfg.Password,
-			"client_id":     c.cfg.ClientId,
-			"client_secret": c.cfg.ClientSecret,
-		}).
-		Post(loginEndpoint)
-	if err != nil {
-		return nil, fmt.Errorf("login request failed: %v", err)
+		restyClient:  restyClient,
+		cfg:          cfg,
+		sessionStore: sessionStore,
 	}
-	log.Printf("Logged in successfully as %v \n", c.cfg.Username)
-	return loginResult, nil
 }
 
 // GetFollowedMangaFeed retrieves the feed of followed manga from the MangaDex API.
 func (c *Client) GetFollowedMangaFeed(ctx context.Context, lastRanAt time.Time) ([]*GodexManga, error) {
-	endpoint := fmt.Sprintf(followedEndpoint, getMangaDexTimeFormat(lastRanAt))
-	chapterResponse := &ChapterList{}
-	_, err := c.restyClient.R().SetContext(ctx).SetResult(chapterResponse).SetAuthToken(c.authToken).Get(endpoint)
+	chapters, err := c.getFollowedChapters(ctx, lastRanAt)
 	if err != nil {
-		return nil, fmt.Errorf("Error getting chapter list: %w", err)
+		return nil, err
 	}
 	mangaMap := make(map[string]*GodexManga, 0)
-	for _, chapter := range chapterResponse.Data {
+	for _, chapter := range chapters {
 		mangaID := chapter.GetManga().ID
 		godexManga, ok := mangaMap[mangaID]
 		if !ok {
@@ -88,9 +78,12 @@ func (c *Client) GetFollowedMangaFeed(ctx context.Context, lastRanAt time.Time)
 	}
 	mangaList := make([]*GodexManga, 0, len(mangaMap))
 	for _, godexManga := range mangaMap {
+		mangaID := godexManga.Manga.ID
+		godexManga.Chapters = filterBlockedGroups(godexManga.Chapters, c.cfg.MangaBlockedGroups(mangaID))
+		godexManga.Chapters = filterLanguages(godexManga.Chapters, c.cfg.MangaLanguages(mangaID))
 		mangaList = append(mangaList, godexManga)
 	}
-	err = c.setReadStatus(ctx, c.authToken, mangaList)
+	err = c.setReadStatus(ctx, mangaList)
 	mangaList = filterAlreadyRead(mangaList)
 	if err != nil {
 		return nil, err
@@ -99,6 +92,135 @@ func (c *Client) GetFollowedMangaFeed(ctx context.Context, lastRanAt time.Time)
 	return mangaList, nil
 }
 
+// getFollowedChapters walks every page of the followed manga feed for chapters created since the given time.
+// MangaDex rejects requests where offset + limit goes past maxFeedWindow, so once a window is exhausted
+// the createdAtSince filter is moved up to the last chapter seen and paging starts over.
+// Chapters are deduplicated by ID since consecutive windows overlap.
+func (c *Client) getFollowedChapters(ctx context.Context, since time.Time) ([]*Chapter, error) {
+	var chapters []*Chapter
+	seen := make(map[string]bool)
+	offset := 0
+
+	for {
+		chapterList := &ChapterList{}
+		_, err := c.authorized(ctx, func(req *resty.Request) (*resty.Response, error) {
+			return req.SetQueryParamsFromValues(url.Values{
+				"limit":                {fmt.Sprintf("%d", feedPageLimit)},
+				"offset":               {fmt.Sprintf("%d", offset)},
+				"translatedLanguage[]": c.cfg.AllLanguages(),
+				"includes[]":           {"manga", "scanlation_group"},
+				"order[createdAt]":     {"asc"},
+				"createdAtSince":       {getMangaDexTimeFormat(since)},
+			}).
+				SetResult(chapterList).
+				Get(followedEndpoint)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Error getting chapter list: %w", err)
+		}
+
+		for _, chapter := range chapterList.Data {
+			if seen[chapter.ID] {
+				continue
+			}
+			seen[chapter.ID] = true
+			chapters = append(chapters, chapter)
+		}
+
+		offset += feedPageLimit
+		if len(chapterList.Data) == 0 || offset >= chapterList.Total {
+			break
+		}
+		if offset+feedPageLimit > maxFeedWindow {
+			next, err := narrowFeedWindow(since, chapterList.Data[len(chapterList.Data)-1])
+			if err != nil {
+				return nil, err
+			}
+			since = next
+			offset = 0
+		}
+	}
+	return chapters, nil
+}
+
+// narrowFeedWindow Computes the createdAtSince value for the next feed window from the last chapter of the current one.
+// It steps back a second from the chapter's creation date so chapters sharing that timestamp aren't lost.
+func narrowFeedWindow(since time.Time, last *Chapter) (time.Time, error) {
+	createdAt, err := time.Parse(time.RFC3339, last.Attributes.CreatedAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error parsing chapter creation date: %w", err)
+	}
+	next := createdAt.Add(-time.Second)
+	if !next.After(since) {
+		return time.Time{}, fmt.Errorf("cannot page past %v chapters created at %v", maxFeedWindow, last.Attributes.CreatedAt)
+	}
+	return next, nil
+}
+
+// filterBlockedGroups Filters out the chapters released by any of the blocked scanlation groups.
+// It runs before the language filter so a blocked translation doesn't hide one in a less preferred language.
+func filterBlockedGroups(chapters []*GodexChapter, blocked []string) []*GodexChapter {
+	if len(blocked) == 0 {
+		return chapters
+	}
+	filtered := make([]*GodexChapter, 0, len(chapters))
+	for _, godexChapter := range chapters {
+		if !releasedByAny(godexChapter.Chapter, blocked) {
+			filtered = append(filtered, godexChapter)
+		}
+	}
+	return filtered
+}
+
+// releasedByAny reports whether one of the groups of a chapter matches one of the given IDs or names.
+func releasedByAny(chapter *Chapter, groups []string) bool {
+	for _, group := range chapter.Groups() {
+		for _, idOrName := range groups {
+			if group.Matches(idOrName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterLanguages Keeps the chapters translated in one of the given languages.
+// When a chapter number is available in several of them, only the translations in the most preferred language are kept.
+func filterLanguages(chapters []*GodexChapter, languages []string) []*GodexChapter {
+	rank := make(map[string]int, len(languages))
+	for i, language := range languages {
+		if _, ok := rank[language]; !ok {
+			rank[language] = i
+		}
+	}
+
+	bestRank := make(map[string]int)
+	for _, godexChapter := range chapters {
+		attributes := godexChapter.Chapter.Attributes
+		languageRank, ok := rank[attributes.TranslatedLanguage]
+		if !ok || attributes.Chapter == nil {
+			continue
+		}
+		if best, seen := bestRank[*attributes.Chapter]; !seen || languageRank < best {
+			bestRank[*attributes.Chapter] = languageRank
+		}
+	}
+
+	filtered := make([]*GodexChapter, 0, len(chapters))
+	for _, godexChapter := range chapters {
+		attributes := godexChapter.Chapter.Attributes
+		languageRank, ok := rank[attributes.TranslatedLanguage]
+		if !ok {
+			continue
+		}
+		if attributes.Chapter != nil && languageRank != bestRank[*attributes.Chapter] {
+			continue
+		}
+		filtered = append(filtered, godexChapter)
+	}
+	return filtered
+}
+
 // filterAlreadyRead Filters out any chapters that are marked as read to not redownload them.
 func filterAlreadyRead(mangaList []*GodexManga) []*GodexManga {
 	for _, godexManga := range mangaList {
@@ -114,13 +236,15 @@ func filterAlreadyRead(mangaList []*GodexManga) []*GodexManga {
 }
 
 // setReadStatus Sets the read status for the chapters collected in GetFollowedMangaFeed
-func (c *Client) setReadStatus(ctx context.Context, authToken string, manga []*GodexManga) error {
+func (c *Client) setReadStatus(ctx context.Context, manga []*GodexManga) error {
 	g, gCtx := errgroup.WithContext(ctx)
 	for _, item := range manga {
 		godexManga := item // create a new variable to avoid data race
 		g.Go(func() error {
 			readMarkers := &ChapterReadMarkers{}
-			_, err := c.restyClient.R().SetContext(gCtx).SetResult(readMarkers).SetAuthToken(authToken).Get(fmt.Sprintf(getReadEndpoint, godexManga.Manga.ID))
+			_, err := c.authorized(gCtx, func(req *resty.Request) (*resty.Response, error) {
+				return req.SetResult(readMarkers).Get(fmt.Sprintf(getReadEndpoint, godexManga.Manga.ID))
+			})
 			if err != nil {
 				return fmt.Errorf("Error getting read markers for manga list: %w", err)
 			}
@@ -155,11 +279,15 @@ func (c *Client) MarkMangaAsRead(ctx context.Context, mangaId string, chaptersTo
 		return fmt.Errorf("error marshalling mark as read payload: %v", err)
 	}
 
-	_, err = c.restyClient.R().SetAuthToken(c.authToken).SetContext(ctx).
-		SetHeader("Content-Type", "application/json").
-		SetBody(jsonPayload).
-		Post(fmt.Sprintf(setReadEndpoint, mangaId))
-	return err
+	_, err = c.authorized(ctx, func(req *resty.Request) (*resty.Response, error) {
+		return req.SetHeader("Content-Type", "application/json").
+			SetBody(jsonPayload).
+			Post(fmt.Sprintf(setReadEndpoint, mangaId))
+	})
+	if err != nil {
+		return fmt.Errorf("error marking chapters as read: %w", err)
+	}
+	return nil
 }
 
 func (c *Client) GetMangaChapters(ctx context.Context, mangaUrl string) (*GodexManga, error) {
@@ -167,36 +295,49 @@ func (c *Client) GetMangaChapters(ctx context.Context, mangaUrl string) (*GodexM
 	if err != nil {
 		return nil, err
 	}
+	chapters, err := c.MangaChapters(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(chapters) == 0 {
+		return nil, fmt.Errorf("no chapters found available for the requested manga")
+	}
+	return &GodexManga{
+		Manga:    chapters[0].Chapter.GetManga(),
+		Chapters: chapters,
+	}, nil
+}
+
+// MangaChapters retrieves every chapter of a manga in the configured languages, leaving out the ones released by blocked groups.
+func (c *Client) MangaChapters(ctx context.Context, mangaID string) ([]*GodexChapter, error) {
 	var chapters []*Chapter
 	offset := 0
 	limit := 100
 
 	for {
 		chapterList := &ChapterList{}
-		_, err := c.restyClient.R().SetContext(ctx).SetAuthToken(c.authToken).
-			SetQueryParams(map[string]string{
-				"limit":                fmt.Sprintf("%d", limit),
-				"offset":               fmt.Sprintf("%d", offset),
-				"manga":                id,
-				"translatedLanguage[]": "en",
-				"includes[]":           "manga",
+		_, err := c.authorized(ctx, func(req *resty.Request) (*resty.Response, error) {
+			return req.SetQueryParamsFromValues(url.Values{
+				"limit":                {fmt.Sprintf("%d", limit)},
+				"offset":               {fmt.Sprintf("%d", offset)},
+				"manga":                {mangaID},
+				"translatedLanguage[]": c.cfg.MangaLanguages(mangaID),
+				"includes[]":           {"manga", "scanlation_group"},
 			}).
-			SetResult(chapterList).
-			Get(chapterEndpoint)
+				SetResult(chapterList).
+				Get(chapterEndpoint)
+		})
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("error getting manga chapters: %w", err)
 		}
 
 		chapters = append(chapters, chapterList.Data...)
 
-		if len(chapters) >= chapterList.Total {
+		if len(chapters) >= chapterList.Total || len(chapterList.Data) == 0 {
 			break
 		}
 		offset += limit
 	}
-	if len(chapters) == 0 {
-		return nil, fmt.Errorf("no chapters found available for the requested manga")
-	}
 	godexChapters := make([]*GodexChapter, len(chapters))
 	for i, chapter := range chapters {
 		godexChapters[i] = &GodexChapter{
@@ -204,10 +345,42 @@ func (c *Client) GetMangaChapters(ctx context.Context, mangaUrl string) (*GodexM
 			IsRead:  false,
 		}
 	}
-	return &GodexManga{
-		Manga:    chapters[0].GetManga(),
-		Chapters: godexChapters,
-	}, nil
+	return filterLanguages(filterBlockedGroups(godexChapters, c.cfg.MangaBlockedGroups(mangaID)), c.cfg.MangaLanguages(mangaID)), nil
+}
+
+// GetMangaAggregate retrieves the volumes of a manga and the chapters MangaDex lists in each of them, in the configured languages.
+func (c *Client) GetMangaAggregate(ctx context.Context, mangaID string) (*MangaAggregate, error) {
+	aggregate := &MangaAggregate{}
+	_, err := c.authorized(ctx, func(req *resty.Request) (*resty.Response, error) {
+		return req.SetQueryParamsFromValues(url.Values{
+			"translatedLanguage[]": c.cfg.MangaLanguages(mangaID),
+		}).
+			SetResult(aggregate).
+			Get(fmt.Sprintf(aggregateEndpoint, mangaID))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting volumes of manga %v: %w", mangaID, err)
+	}
+	return aggregate, nil
+}
+
+// SearchManga looks up manga by title, whatever their content rating. MangaDex returns the most relevant ones first.
+func (c *Client) SearchManga(ctx context.Context, title string) ([]*Manga, error) {
+	mangaList := &MangaList{}
+	_, err := c.authorized(ctx, func(req *resty.Request) (*resty.Response, error) {
+		return req.SetQueryParamsFromValues(url.Values{
+			"title":            {title},
+			"limit":            {"10"},
+			"contentRating[]":  {"safe", "suggestive", "erotica", "pornographic"},
+			"order[relevance]": {"desc"},
+		}).
+			SetResult(mangaList).
+			Get(mangaEndpoint)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching manga %q: %w", title, err)
+	}
+	return mangaList.Data, nil
 }
 
 func extractMangaId(mangaUrl string) (string, error) {
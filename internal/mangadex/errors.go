@@ -0,0 +1,101 @@
+package mangadex
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// APIError : An unsuccessful HTTP response from MangaDex or one of the download sources.
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	RequestID  string
+	Errors     []ErrorDetail
+}
+
+// ErrorDetail : A single entry of the errors array returned by MangaDex.
+type ErrorDetail struct {
+	ID     string `json:"id"`
+	Status int    `json:"status"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+// errorResponse : The body of an error response, either from the API or from the OAuth token endpoint.
+type errorResponse struct {
+	Result           string        `json:"result"`
+	Errors           []ErrorDetail `json:"errors"`
+	Error            string        `json:"error"`
+	ErrorDescription string        `json:"error_description"`
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v %v: %v", e.Method, e.URL, e.Status)
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, " (request %v)", e.RequestID)
+	}
+	for _, detail := range e.Errors {
+		fmt.Fprintf(&b, ": %v", detail.Title)
+		if detail.Detail != "" {
+			fmt.Fprintf(&b, " (%v)", detail.Detail)
+		}
+	}
+	return b.String()
+}
+
+// IsUnauthorized reports whether the request was rejected because of missing or invalid credentials.
+func (e *APIError) IsUnauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// IsNotFound reports whether the requested resource does not exist, or was removed for good.
+func (e *APIError) IsNotFound() bool {
+	return e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone
+}
+
+// IsRateLimited reports whether the request was rejected by rate limiting.
+func (e *APIError) IsRateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+// IsServerError reports whether the server failed to handle the request.
+func (e *APIError) IsServerError() bool {
+	return e.StatusCode >= http.StatusInternalServerError
+}
+
+// CheckResponse turns the outcome of a resty request into an error.
+// Transport errors are returned as is, non-2xx responses are returned as an *APIError.
+func CheckResponse(resp *resty.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	if !resp.IsError() {
+		return nil
+	}
+	apiErr := &APIError{
+		Method:     resp.Request.Method,
+		URL:        resp.Request.URL,
+		StatusCode: resp.StatusCode(),
+		Status:     resp.Status(),
+		RequestID:  resp.Header().Get("X-Request-ID"),
+	}
+	body := &errorResponse{}
+	if json.Unmarshal(resp.Body(), body) == nil {
+		apiErr.Errors = body.Errors
+		if body.Error != "" {
+			apiErr.Errors = append(apiErr.Errors, ErrorDetail{
+				Status: resp.StatusCode(),
+				Title:  body.Error,
+				Detail: body.ErrorDescription,
+			})
+		}
+	}
+	return apiErr
+}
@@ -5,6 +5,9 @@ package mangadex
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 )
 
 // EnvConfigs struct to map env values
@@ -22,10 +25,354 @@ type Config struct {
 	ClientId     string
 	ClientSecret string
 	DownloadPath string
+	// RateLimit is the number of requests per second sent to each MangaDex API host.
+	RateLimit float64
+	// AtHomeRateLimit is the number of requests per minute sent to the at-home server endpoint.
+	AtHomeRateLimit float64
+	// MaxRetries is how many times a failed request is retried.
+	MaxRetries int
+	// ImageQuality is the quality of the pages downloaded from MangaDex.
+	ImageQuality ImageQuality
+	// PageValidation is how thoroughly downloaded pages are checked before they are archived.
+	PageValidation PageValidation
+	// Languages is the ordered list of preferred translation languages.
+	Languages []string
+	// Manga holds the settings overriding the global ones for specific manga, keyed by manga ID.
+	Manga map[string]MangaConfig
+	// Filenames controls how titles are turned into file and folder names.
+	Filenames FilenameConfig
+	// DuplicateChapters decides what to do with chapters released several times under the same number.
+	DuplicateChapters DuplicatePolicy
+	// PreferredGroups lists scanlation groups, by ID or name, in order of preference when choosing among duplicate chapters.
+	PreferredGroups []string
+	// BlockedGroups lists scanlation groups, by ID or name, whose chapters are never downloaded.
+	BlockedGroups []string
+	// Packaging decides whether chapters are archived on their own or packed into volumes.
+	Packaging Packaging
+	// Format is the file format of the archives.
+	Format ArchiveFormat
+	// Processing controls how page images are processed for e-readers before they are archived.
+	Processing ProcessingConfig
+}
+
+// ProcessingConfig : How page images are processed for e-readers before they are archived.
+type ProcessingConfig struct {
+	// Profile is the e-reader pages are processed for, empty to archive pages as downloaded.
+	Profile string
+	// Width and Height override the screen size of the profile, pages are scaled down to fit in it.
+	Width  int
+	Height int
+	// Grayscale overrides whether pages are converted to gray levels, which the profiles of e-ink screens without colors do.
+	Grayscale *bool
+	// Gamma darkens pages above 1 and lightens them below 1.
+	Gamma float64
+	// Contrast scales the contrast of pages, 1 leaving it unchanged.
+	Contrast float64
+	// Quality is the JPEG quality pages are encoded in, from 1 to 100.
+	Quality int
+	// Spreads overrides how the profile shows double-page spreads.
+	Spreads SpreadMode
+	// Crop trims the uniform borders of pages.
+	Crop CropConfig
+	// Transcode converts the pages in formats readers don't handle well, such as WebP, to JPEG or PNG, even without a profile.
+	// When unset, it depends on the archive format and profile, see Config.MangaTranscode.
+	Transcode *bool
+}
+
+// CropConfig : How the uniform borders of pages are detected and trimmed.
+type CropConfig struct {
+	// Enabled turns border cropping on.
+	Enabled bool
+	// Tolerance is the share of the pixels of a border line allowed to stand out from the border, so noise doesn't stop cropping.
+	Tolerance float64
+	// Threshold is how many levels a pixel can be away from the border color and still be part of the border.
+	Threshold int
+	// MaxPercent is the largest share of the width or height of a page cropped on each side.
+	MaxPercent float64
+	// PageNumbers crops the page numbers standing alone in the top or bottom border along with the border.
+	PageNumbers bool
+}
+
+// SpreadMode : How double-page spreads, pages wider than they are high, are shown on an e-reader.
+type SpreadMode string
+
+const (
+	// SpreadKeep leaves spreads as they are, scaled down to fit the screen.
+	SpreadKeep SpreadMode = "keep"
+	// SpreadSplit splits spreads into two pages, in reading order.
+	SpreadSplit SpreadMode = "split"
+	// SpreadRotate rotates spreads so they fill the screen when the e-reader is turned.
+	SpreadRotate SpreadMode = "rotate"
+	// SpreadBoth shows spreads rotated first, then split into two pages.
+	SpreadBoth SpreadMode = "both"
+)
+
+// ParseSpreadMode validates a spread mode coming from the configuration.
+func ParseSpreadMode(mode string) (SpreadMode, error) {
+	switch SpreadMode(mode) {
+	case SpreadKeep, SpreadSplit, SpreadRotate, SpreadBoth:
+		return SpreadMode(mode), nil
+	default:
+		return "", fmt.Errorf("unknown spread mode %q, expected %q, %q, %q or %q", mode, SpreadKeep, SpreadSplit, SpreadRotate, SpreadBoth)
+	}
+}
+
+// ArchiveFormat : The file format chapters and volumes are archived in.
+type ArchiveFormat string
+
+const (
+	// FormatCBZ archives pages in a zip along with a ComicInfo document.
+	FormatCBZ ArchiveFormat = "cbz"
+	// FormatEPUB archives pages in a fixed-layout EPUB3.
+	FormatEPUB ArchiveFormat = "epub"
+	// FormatKEPUB archives pages in a fixed-layout EPUB3 with the markup Kobo readers expect.
+	FormatKEPUB ArchiveFormat = "kepub"
+	// FormatPDF archives pages in a PDF document.
+	FormatPDF ArchiveFormat = "pdf"
+)
+
+// ParseArchiveFormat validates an archive format coming from the configuration.
+func ParseArchiveFormat(format string) (ArchiveFormat, error) {
+	switch ArchiveFormat(format) {
+	case FormatCBZ, FormatEPUB, FormatKEPUB, FormatPDF:
+		return ArchiveFormat(format), nil
+	default:
+		return "", fmt.Errorf("unknown archive format %q, expected %q, %q, %q or %q", format, FormatCBZ, FormatEPUB, FormatKEPUB, FormatPDF)
+	}
+}
+
+// Packaging : How downloaded chapters are packed into archives.
+type Packaging string
+
+const (
+	// PackageChapters archives every chapter on its own.
+	PackageChapters Packaging = "chapter"
+	// PackageVolumes packs the chapters of a volume into a single archive once the volume is complete.
+	PackageVolumes Packaging = "volume"
+)
+
+// ParsePackaging validates a packaging mode coming from the configuration.
+func ParsePackaging(packaging string) (Packaging, error) {
+	switch Packaging(packaging) {
+	case PackageChapters, PackageVolumes:
+		return Packaging(packaging), nil
+	default:
+		return "", fmt.Errorf("unknown packaging %q, expected %q or %q", packaging, PackageChapters, PackageVolumes)
+	}
+}
+
+// DuplicatePolicy : What to do with chapters released several times under the same number, usually by different groups.
+type DuplicatePolicy string
+
+const (
+	// DuplicateKeepFirst keeps the earliest published release of a chapter.
+	DuplicateKeepFirst DuplicatePolicy = "keep-first"
+	// DuplicatePreferGroup keeps the release from the most preferred group, falling back on the earliest one.
+	DuplicatePreferGroup DuplicatePolicy = "prefer-group"
+	// DuplicateKeepAll keeps every release, naming files after their group to tell them apart.
+	DuplicateKeepAll DuplicatePolicy = "keep-all"
+)
+
+// ParseDuplicatePolicy validates a duplicate chapters policy coming from the configuration.
+func ParseDuplicatePolicy(policy string) (DuplicatePolicy, error) {
+	switch DuplicatePolicy(policy) {
+	case DuplicateKeepFirst, DuplicatePreferGroup, DuplicateKeepAll:
+		return DuplicatePolicy(policy), nil
+	default:
+		return "", fmt.Errorf("unknown duplicate chapters policy %q, expected %q, %q or %q",
+			policy, DuplicateKeepFirst, DuplicatePreferGroup, DuplicateKeepAll)
+	}
+}
+
+// FilenameConfig : How titles are turned into file and folder names.
+type FilenameConfig struct {
+	// Replacement replaces the characters that aren't allowed in file names.
+	Replacement string
+	// MaxLength is the maximum length of a name in bytes.
+	MaxLength int
+	// Normalization is the Unicode normalization form applied to names: NFC, NFD, NFKC, NFKD or none.
+	Normalization string
+	// Template lays out the path of chapter archives in the download directory.
+	Template string
+	// VolumeTemplate lays out the path of volume archives in the download directory.
+	VolumeTemplate string
+}
+
+// MangaConfig : Settings of a specific manga.
+type MangaConfig struct {
+	// Languages is the ordered list of preferred translation languages for this manga.
+	Languages []string
+	// PreferredGroups lists scanlation groups in order of preference for this manga, before the global ones.
+	PreferredGroups []string
+	// BlockedGroups lists scanlation groups blocked for this manga, on top of the global ones.
+	BlockedGroups []string
+	// Packaging overrides how the chapters of this manga are packed into archives.
+	Packaging Packaging
+	// Format overrides the file format of the archives of this manga.
+	Format ArchiveFormat
+	// Spreads overrides how double-page spreads of this manga are shown.
+	Spreads SpreadMode
+}
+
+// MangaLanguages returns the preferred translation languages of a manga.
+func (c *Config) MangaLanguages(mangaID string) []string {
+	if mangaConfig, ok := c.Manga[mangaID]; ok && len(mangaConfig.Languages) > 0 {
+		return mangaConfig.Languages
+	}
+	return c.Languages
+}
+
+// MangaPreferredGroups returns the preferred scanlation groups of a manga, the manga specific ones first.
+func (c *Config) MangaPreferredGroups(mangaID string) []string {
+	groups := append([]string{}, c.Manga[mangaID].PreferredGroups...)
+	return append(groups, c.PreferredGroups...)
+}
+
+// MangaBlockedGroups returns the scanlation groups blocked for a manga, globally or specifically.
+func (c *Config) MangaBlockedGroups(mangaID string) []string {
+	groups := append([]string{}, c.BlockedGroups...)
+	return append(groups, c.Manga[mangaID].BlockedGroups...)
+}
+
+// MangaPackaging returns how the chapters of a manga are packed into archives.
+func (c *Config) MangaPackaging(mangaID string) Packaging {
+	if packaging := c.Manga[mangaID].Packaging; packaging != "" {
+		return packaging
+	}
+	return c.Packaging
+}
+
+// MangaFormat returns the file format of the archives of a manga.
+func (c *Config) MangaFormat(mangaID string) ArchiveFormat {
+	if format := c.Manga[mangaID].Format; format != "" {
+		return format
+	}
+	return c.Format
+}
+
+// MangaTranscode tells if the pages of a manga are converted from the formats readers don't handle well.
+// Unless configured, pages are converted when archived as they are in any format but EPUB, whose readers all handle WebP and GIF.
+// Pages processed for a profile are encoded in JPEG anyway, so they aren't converted first.
+func (c *Config) MangaTranscode(mangaID string) bool {
+	if c.Processing.Transcode != nil {
+		return *c.Processing.Transcode
+	}
+	return c.Processing.Profile == "" && c.MangaFormat(mangaID) != FormatEPUB
+}
+
+// MangaProcessing returns how the pages of a manga are processed before they are archived.
+func (c *Config) MangaProcessing(mangaID string) ProcessingConfig {
+	processing := c.Processing
+	if spreads := c.Manga[mangaID].Spreads; spreads != "" {
+		processing.Spreads = spreads
+	}
+	return processing
+}
+
+// AllLanguages returns every translation language configured, globally or for any manga.
+func (c *Config) AllLanguages() []string {
+	seen := make(map[string]bool)
+	languages := make([]string, 0, len(c.Languages))
+	add := func(list []string) {
+		for _, language := range list {
+			if !seen[language] {
+				seen[language] = true
+				languages = append(languages, language)
+			}
+		}
+	}
+	add(c.Languages)
+	mangaIDs := make([]string, 0, len(c.Manga))
+	for mangaID := range c.Manga {
+		mangaIDs = append(mangaIDs, mangaID)
+	}
+	sort.Strings(mangaIDs)
+	for _, mangaID := range mangaIDs {
+		add(c.Manga[mangaID].Languages)
+	}
+	return languages
+}
+
+// ImageQuality : The quality of the page images served by MangaDex@Home.
+type ImageQuality string
+
+const (
+	// QualityData is the original quality of the uploaded pages.
+	QualityData ImageQuality = "data"
+	// QualityDataSaver is the compressed version of the pages.
+	QualityDataSaver ImageQuality = "data-saver"
+)
+
+// PageValidation : How thoroughly downloaded page images are decoded to check them.
+type PageValidation string
+
+const (
+	// ValidateHeader only decodes the header of page images.
+	ValidateHeader PageValidation = "header"
+	// ValidateFull decodes page images entirely, which catches the pages whose data is corrupt.
+	ValidateFull PageValidation = "full"
+)
+
+// ParsePageValidation validates a page validation mode coming from the configuration.
+func ParsePageValidation(validation string) (PageValidation, error) {
+	switch PageValidation(validation) {
+	case ValidateHeader, ValidateFull:
+		return PageValidation(validation), nil
+	default:
+		return "", fmt.Errorf("unknown page validation %q, expected %q or %q", validation, ValidateHeader, ValidateFull)
+	}
+}
+
+// ParseImageQuality validates an image quality coming from the configuration or the command line.
+func ParseImageQuality(quality string) (ImageQuality, error) {
+	switch ImageQuality(quality) {
+	case QualityData, QualityDataSaver:
+		return ImageQuality(quality), nil
+	default:
+		return "", fmt.Errorf("unknown image quality %q, expected %q or %q", quality, QualityData, QualityDataSaver)
+	}
 }
 
 type LoginResponse struct {
-	AccessToken string `json:"access_token"`
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	RefreshExpiresIn int    `json:"refresh_expires_in"`
+}
+
+// Session : The OAuth tokens of a logged in user along with when they expire.
+type Session struct {
+	Username         string    `json:"username"`
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// newSession builds a session out of a token response, computing the expiry dates from the given time.
+func newSession(username string, loginResponse *LoginResponse, now time.Time) *Session {
+	session := &Session{
+		Username:     username,
+		AccessToken:  loginResponse.AccessToken,
+		RefreshToken: loginResponse.RefreshToken,
+		ExpiresAt:    now.Add(time.Duration(loginResponse.ExpiresIn) * time.Second),
+	}
+	// A refresh_expires_in of 0 means the refresh token does not expire.
+	if loginResponse.RefreshExpiresIn > 0 {
+		session.RefreshExpiresAt = now.Add(time.Duration(loginResponse.RefreshExpiresIn) * time.Second)
+	}
+	return session
+}
+
+// IsValid checks whether the access token is still usable for at least the given duration.
+func (s *Session) IsValid(margin time.Duration) bool {
+	return s != nil && s.AccessToken != "" && time.Now().Add(margin).Before(s.ExpiresAt)
+}
+
+// CanRefresh checks whether the refresh token can still be exchanged for a new access token.
+func (s *Session) CanRefresh() bool {
+	return s != nil && s.RefreshToken != "" &&
+		(s.RefreshExpiresAt.IsZero() || time.Now().Before(s.RefreshExpiresAt))
 }
 
 type Manga struct {
@@ -34,6 +381,109 @@ type Manga struct {
 	Attributes MangaAttributes `json:"attributes"`
 }
 
+type MangaList struct {
+	Result   string   `json:"result"`
+	Response string   `json:"response"`
+	Data     []*Manga `json:"data"`
+	Limit    int      `json:"limit"`
+	Offset   int      `json:"offset"`
+	Total    int      `json:"total"`
+}
+
+// MangaAggregate : The volumes of a manga and the chapters in each of them, as listed by MangaDex, keyed by volume number.
+// Chapters without a volume are listed under the "none" volume, and chapters without a number under the "none" chapter.
+type MangaAggregate struct {
+	Result  string
+	Volumes map[string]*AggregateVolume
+}
+
+// AggregateVolume : A volume of a manga along with its chapters, keyed by chapter number.
+type AggregateVolume struct {
+	Volume   string
+	Count    int
+	Chapters map[string]*AggregateChapter
+}
+
+// AggregateChapter : A chapter number of a volume, ID being one of its releases and Others the other ones.
+type AggregateChapter struct {
+	Chapter string   `json:"chapter"`
+	ID      string   `json:"id"`
+	Others  []string `json:"others"`
+	Count   int      `json:"count"`
+}
+
+// AggregateNone is the key of the volume, or chapter, gathering the chapters without one.
+const AggregateNone = "none"
+
+// IDs returns the IDs of every release of the chapter.
+func (c *AggregateChapter) IDs() []string {
+	return append([]string{c.ID}, c.Others...)
+}
+
+// UnmarshalJSON decodes the aggregate of a manga. MangaDex sends the volumes as an array instead of an object
+// when they are empty or keyed by consecutive numbers from 0, they are then keyed by their number here.
+func (a *MangaAggregate) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Result  string          `json:"result"`
+		Volumes json.RawMessage `json:"volumes"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	a.Result = raw.Result
+	a.Volumes = map[string]*AggregateVolume{}
+	if !isJSONArray(raw.Volumes) {
+		return unmarshalOptional(raw.Volumes, &a.Volumes)
+	}
+	var volumes []*AggregateVolume
+	if err := json.Unmarshal(raw.Volumes, &volumes); err != nil {
+		return err
+	}
+	for _, volume := range volumes {
+		a.Volumes[volume.Volume] = volume
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes a volume of an aggregate, whose chapters can be sent as an array as well.
+func (v *AggregateVolume) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Volume   string          `json:"volume"`
+		Count    int             `json:"count"`
+		Chapters json.RawMessage `json:"chapters"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	v.Volume = raw.Volume
+	v.Count = raw.Count
+	v.Chapters = map[string]*AggregateChapter{}
+	if !isJSONArray(raw.Chapters) {
+		return unmarshalOptional(raw.Chapters, &v.Chapters)
+	}
+	var chapters []*AggregateChapter
+	if err := json.Unmarshal(raw.Chapters, &chapters); err != nil {
+		return err
+	}
+	for _, chapter := range chapters {
+		v.Chapters[chapter.Chapter] = chapter
+	}
+	return nil
+}
+
+// isJSONArray tells if a JSON value is an array.
+func isJSONArray(data json.RawMessage) bool {
+	return len(data) > 0 && data[0] == '['
+}
+
+// unmarshalOptional decodes a JSON value into v, leaving it as it is when the value is missing or null.
+func unmarshalOptional(data json.RawMessage, v interface{}) error {
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
 type ChapterList struct {
 	Result   string     `json:"result"`
 	Response string     `json:"response"`
@@ -48,6 +498,62 @@ type LocalisedStrings struct {
 	Values map[string]string
 }
 
+// Preferred returns the string in the first of the given languages that is available, or an empty string.
+func (l LocalisedStrings) Preferred(languages []string) string {
+	for _, language := range languages {
+		if value := l.Values[language]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Any returns a string in any language, picking the first language in alphabetical order so the result is stable.
+func (l LocalisedStrings) Any() string {
+	languages := make([]string, 0, len(l.Values))
+	for language, value := range l.Values {
+		if value != "" {
+			languages = append(languages, language)
+		}
+	}
+	if len(languages) == 0 {
+		return ""
+	}
+	sort.Strings(languages)
+	return l.Values[languages[0]]
+}
+
+// Title resolves the title of a manga in the first available of the preferred languages.
+// It falls back on the alternative titles in those languages, then on the titles in the manga's original language
+// or its romanization, and finally on any title.
+func (m *Manga) Title(languages []string) string {
+	attributes := m.Attributes
+	originalLanguages := []string{attributes.OriginalLanguage, attributes.OriginalLanguage + "-ro"}
+	for _, title := range []string{
+		attributes.Title.Preferred(languages),
+		attributes.AltTitles.Preferred(languages),
+		attributes.Title.Preferred(originalLanguages),
+		attributes.AltTitles.Preferred(originalLanguages),
+		attributes.Title.Any(),
+		attributes.AltTitles.Any(),
+	} {
+		if title != "" {
+			return title
+		}
+	}
+	return m.ID
+}
+
+// RightToLeft tells if a manga is read from right to left, which is the case of Japanese manga.
+func (m *Manga) RightToLeft() bool {
+	switch m.Attributes.OriginalLanguage {
+	case "ja", "ja-ro":
+		return true
+	default:
+		return false
+	}
+}
+
 // MangaAttributes : Attributes for a Manga.
 type MangaAttributes struct {
 	Title                  LocalisedStrings `json:"title"`
@@ -79,6 +585,8 @@ type Chapter struct {
 type GodexChapter struct {
 	Chapter *Chapter
 	IsRead  bool
+	// Quality is the quality the chapter was downloaded in, empty until it is downloaded.
+	Quality ImageQuality
 }
 type GodexManga struct {
 	Manga    *Manga
@@ -99,6 +607,40 @@ type ChapterAttributes struct {
 	PublishAt          string  `json:"publishAt"`
 }
 
+// ScanlationGroup : Struct containing information on a scanlation group.
+type ScanlationGroup struct {
+	ID         string                    `json:"id"`
+	Type       string                    `json:"type"`
+	Attributes ScanlationGroupAttributes `json:"attributes"`
+}
+
+// ScanlationGroupAttributes : Attributes for a ScanlationGroup.
+type ScanlationGroupAttributes struct {
+	Name        string             `json:"name"`
+	AltNames    []LocalisedStrings `json:"altNames"`
+	Website     *string            `json:"website"`
+	Description *string            `json:"description"`
+	Official    bool               `json:"official"`
+	Inactive    bool               `json:"inactive"`
+	Version     int                `json:"version"`
+	CreatedAt   string             `json:"createdAt"`
+	UpdatedAt   string             `json:"updatedAt"`
+}
+
+// Matches reports whether the group is the one designated by an ID or a name, as written in the configuration.
+// Names are compared case-insensitively.
+func (g *ScanlationGroup) Matches(idOrName string) bool {
+	return g.ID == idOrName || (g.Attributes.Name != "" && strings.EqualFold(g.Attributes.Name, idOrName))
+}
+
+// Label returns the name of the group, or the start of its ID when the name wasn't included in the response.
+func (g *ScanlationGroup) Label() string {
+	if g.Attributes.Name != "" {
+		return g.Attributes.Name
+	}
+	return strings.SplitN(g.ID, "-", 2)[0]
+}
+
 type Relationship struct {
 	ID         string      `json:"id"`
 	Type       string      `json:"type"`
@@ -120,6 +662,8 @@ func (a *Relationship) UnmarshalJSON(data []byte) error {
 	switch typ.Type {
 	case "manga":
 		a.Attributes = &MangaAttributes{}
+	case "scanlation_group":
+		a.Attributes = &ScanlationGroupAttributes{}
 	default:
 		a.Attributes = &json.RawMessage{}
 	}
@@ -135,6 +679,14 @@ func (a *Relationship) UnmarshalJSON(data []byte) error {
 	return err
 }
 
+// MarshalJSON encodes the strings the way MangaDex sends them, so they can be decoded back.
+func (l LocalisedStrings) MarshalJSON() ([]byte, error) {
+	if l.Values == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(l.Values)
+}
+
 func (l *LocalisedStrings) UnmarshalJSON(data []byte) error {
 	l.Values = map[string]string{}
 
@@ -158,6 +710,33 @@ func (l *LocalisedStrings) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Label returns how a chapter is referred to: its number, or "Oneshot" followed by its title for chapters without a number.
+func (c *Chapter) Label() string {
+	if c.Attributes.Chapter != nil && *c.Attributes.Chapter != "" {
+		return *c.Attributes.Chapter
+	}
+	if c.Attributes.Title != "" {
+		return "Oneshot - " + c.Attributes.Title
+	}
+	return "Oneshot"
+}
+
+// Groups returns the scanlation groups that released the chapter.
+// Their attributes are empty unless the groups were included in the response.
+func (c *Chapter) Groups() []*ScanlationGroup {
+	var groups []*ScanlationGroup
+	for _, rel := range c.Relationships {
+		if rel.Type == "scanlation_group" {
+			group := &ScanlationGroup{ID: rel.ID, Type: rel.Type}
+			if groupAttr, ok := rel.Attributes.(*ScanlationGroupAttributes); ok {
+				group.Attributes = *groupAttr
+			}
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
 func (c *Chapter) GetManga() *Manga {
 	var manga *Manga
 	for _, rel := range c.Relationships {
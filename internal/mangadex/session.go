@@ -0,0 +1,152 @@
+package mangadex
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// refreshMargin is how long before its expiry an access token gets refreshed.
+const refreshMargin = time.Minute
+
+// SessionStore persists the MangaDex session between runs.
+type SessionStore interface {
+	// LoadSession returns the saved session, or nil if there is none.
+	LoadSession() (*Session, error)
+	// SaveSession saves the session for future runs.
+	SaveSession(session *Session) error
+}
+
+// Login Tries to authenticate a user using the provided credentials
+func (c *Client) Login(ctx context.Context) (*LoginResponse, error) {
+	loginResult, err := c.requestToken(ctx, map[string]string{
+		"grant_type": "password",
+		"username":   c.cfg.Username,
+		"password":   c.cfg.Password,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("login request failed: %w", err)
+	}
+	log.Printf("Logged in successfully as %v \n", c.cfg.Username)
+	return loginResult, nil
+}
+
+// Authenticate makes sure the client holds a usable session.
+// It reuses the stored session when possible, refreshes it if the access token expired
+// and only falls back to the password grant when there is no refreshable session.
+func (c *Client) Authenticate(ctx context.Context) error {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+
+	if c.session == nil && c.sessionStore != nil {
+		session, err := c.sessionStore.LoadSession()
+		if err != nil {
+			log.Printf("Ignoring saved session: %v", err)
+		} else if session != nil && session.Username == c.cfg.Username {
+			c.session = session
+		}
+	}
+	_, err := c.ensureSession(ctx, "")
+	return err
+}
+
+// accessToken returns an access token valid for at least refreshMargin, refreshing the session if needed.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	return c.ensureSession(ctx, "")
+}
+
+// renewAccessToken returns a fresh access token after the given one was rejected.
+// If another request already renewed the session, the current token is returned as is.
+func (c *Client) renewAccessToken(ctx context.Context, rejected string) (string, error) {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	return c.ensureSession(ctx, rejected)
+}
+
+// ensureSession returns the access token of the current session, renewing it when it is about to expire
+// or when it matches the rejected token. The caller must hold sessionMu.
+func (c *Client) ensureSession(ctx context.Context, rejected string) (string, error) {
+	if c.session.IsValid(refreshMargin) && c.session.AccessToken != rejected {
+		return c.session.AccessToken, nil
+	}
+
+	var loginResult *LoginResponse
+	var err error
+	if c.session.CanRefresh() {
+		loginResult, err = c.refresh(ctx, c.session.RefreshToken)
+		if err != nil {
+			log.Printf("Could not refresh session, logging in again: %v", err)
+		}
+	}
+	if loginResult == nil {
+		loginResult, err = c.Login(ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	c.session = newSession(c.cfg.Username, loginResult, time.Now())
+	if c.sessionStore != nil {
+		if err := c.sessionStore.SaveSession(c.session); err != nil {
+			log.Printf("Could not save session: %v", err)
+		}
+	}
+	return c.session.AccessToken, nil
+}
+
+// refresh exchanges a refresh token for a new set of tokens.
+func (c *Client) refresh(ctx context.Context, refreshToken string) (*LoginResponse, error) {
+	loginResult, err := c.requestToken(ctx, map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": refreshToken,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("refresh request failed: %w", err)
+	}
+	return loginResult, nil
+}
+
+// requestToken posts a grant to the token endpoint, adding the client credentials to it.
+func (c *Client) requestToken(ctx context.Context, formData map[string]string) (*LoginResponse, error) {
+	formData["client_id"] = c.cfg.ClientId
+	formData["client_secret"] = c.cfg.ClientSecret
+
+	loginResult := &LoginResponse{}
+	err := CheckResponse(c.restyClient.R().SetContext(ctx).SetResult(loginResult).
+		SetFormData(formData).
+		Post(loginEndpoint))
+	if err != nil {
+		return nil, err
+	}
+	if loginResult.AccessToken == "" {
+		return nil, fmt.Errorf("token endpoint did not return an access token")
+	}
+	return loginResult, nil
+}
+
+// authorized sends an authenticated request built by send.
+// If MangaDex rejects the access token, the session is renewed and the request is sent once more.
+// Non-2xx responses are returned as an *APIError.
+func (c *Client) authorized(ctx context.Context, send func(req *resty.Request) (*resty.Response, error)) (*resty.Response, error) {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := send(c.restyClient.R().SetContext(ctx).SetAuthToken(token))
+	if err != nil || resp.StatusCode() != http.StatusUnauthorized {
+		return resp, CheckResponse(resp, err)
+	}
+
+	token, err = c.renewAccessToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	resp, err = send(c.restyClient.R().SetContext(ctx).SetAuthToken(token))
+	return resp, CheckResponse(resp, err)
+}
@@ -0,0 +1,173 @@
+package naming
+
+import (
+	"bytes"
+	"fmt"
+	"godex/internal/mangadex"
+	"godex/internal/util"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// DefaultTemplate reproduces the original layout: one folder per manga holding one archive per chapter.
+const DefaultTemplate = `{{.Manga}}/{{.Name}}{{if and .KeepAll .Group}} [{{.Group}}]{{end}}`
+
+// DefaultVolumeTemplate puts volume archives next to the chapter archives of the manga.
+const DefaultVolumeTemplate = `{{.Manga}}/Volume {{pad 2 .Volume}}`
+
+// Fields are the values available to path templates.
+type Fields struct {
+	// Manga is the folder name of the manga, kept the same when its title changes on MangaDex.
+	Manga string
+	// Title is the current title of the manga in the preferred languages.
+	Title   string
+	MangaID string
+	// Chapter is the chapter number, empty for oneshots.
+	Chapter string
+	// Name is the chapter number, or "Oneshot - <title>" for oneshots.
+	Name         string
+	ChapterTitle string
+	Volume       string
+	// Group lists the names of the scanlation groups of the chapter.
+	Group     string
+	Language  string
+	ChapterID string
+	// KeepAll is true when every release of a chapter number is kept, names then have to tell groups apart.
+	KeepAll bool
+}
+
+// NewFields collects the template values of a chapter.
+func NewFields(folder string, title string, chapter *mangadex.Chapter, keepAll bool) Fields {
+	attributes := chapter.Attributes
+	groups := make([]string, 0)
+	for _, group := range chapter.Groups() {
+		groups = append(groups, group.Label())
+	}
+	fields := Fields{
+		Manga:        folder,
+		Title:        title,
+		Name:         chapter.Label(),
+		ChapterTitle: attributes.Title,
+		Group:        strings.Join(groups, ", "),
+		Language:     attributes.TranslatedLanguage,
+		ChapterID:    chapter.ID,
+		KeepAll:      keepAll,
+	}
+	if manga := chapter.GetManga(); manga != nil {
+		fields.MangaID = manga.ID
+	}
+	if attributes.Chapter != nil {
+		fields.Chapter = *attributes.Chapter
+	}
+	if attributes.Volume != nil {
+		fields.Volume = *attributes.Volume
+	}
+	return fields
+}
+
+// NewVolumeFields collects the template values of a volume out of its chapters.
+// Chapter fields are empty, Name is "Volume <number>" and Group lists the groups of every chapter.
+func NewVolumeFields(folder string, title string, mangaID string, volume string, chapters []*mangadex.Chapter) Fields {
+	seen := make(map[string]bool)
+	groups := make([]string, 0)
+	languages := make([]string, 0)
+	for _, chapter := range chapters {
+		for _, group := range chapter.Groups() {
+			if !seen[group.ID] {
+				seen[group.ID] = true
+				groups = append(groups, group.Label())
+			}
+		}
+		if language := chapter.Attributes.TranslatedLanguage; !seen[language] {
+			seen[language] = true
+			languages = append(languages, language)
+		}
+	}
+	return Fields{
+		Manga:    folder,
+		Title:    title,
+		MangaID:  mangaID,
+		Name:     "Volume " + volume,
+		Volume:   volume,
+		Group:    strings.Join(groups, ", "),
+		Language: strings.Join(languages, ", "),
+	}
+}
+
+// Template turns the fields of a chapter into the path of its archive.
+type Template struct {
+	tmpl *template.Template
+}
+
+var funcs = template.FuncMap{
+	"pad": pad,
+}
+
+// Parse parses a path template.
+// Templates use the text/template syntax, "/" separates folders and the archive extension is added afterwards.
+// The template is tried on sample values so mistyped fields are reported right away.
+func Parse(text string) (*Template, error) {
+	tmpl, err := template.New("path").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path template: %w", err)
+	}
+	t := &Template{tmpl: tmpl}
+	sample := Fields{Manga: "Manga", Title: "Manga", Chapter: "1", Name: "1", Volume: "1", Group: "Group", Language: "en"}
+	if _, err := t.Path(sample, mangadex.FilenameConfig{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Path renders the template into a path relative to the download directory, without extension.
+// Each folder and file name is sanitized on its own, and a "/" inside a value never creates a folder.
+// Empty folder names are dropped, so conditional sections can leave out a whole folder,
+// but an empty file name is an error: the path would otherwise name the folder holding the archive.
+func (t *Template) Path(fields Fields, cfg mangadex.FilenameConfig) (string, error) {
+	var b bytes.Buffer
+	if err := t.tmpl.Execute(&b, escapeSeparators(fields)); err != nil {
+		return "", fmt.Errorf("error rendering path template: %w", err)
+	}
+	names := strings.Split(b.String(), "/")
+	var segments []string
+	for _, segment := range names[:len(names)-1] {
+		if name := util.SanitizeFilename(segment, cfg); name != "" {
+			segments = append(segments, name)
+		}
+	}
+	name := util.SanitizeFilename(names[len(names)-1], cfg)
+	if name == "" {
+		return "", fmt.Errorf("path template rendered an empty file name for chapter %v", fields.Name)
+	}
+	return filepath.Join(append(segments, name)...), nil
+}
+
+// escapeSeparators swaps the "/" in values for a backslash, which is then replaced like any invalid character.
+func escapeSeparators(fields Fields) Fields {
+	value := reflect.ValueOf(&fields).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		if field := value.Field(i); field.Kind() == reflect.String {
+			field.SetString(strings.ReplaceAll(field.String(), "/", `\`))
+		}
+	}
+	return fields
+}
+
+// pad zero-pads the integer part of a number to the given width, keeping any decimal part: pad 3 "21.5" is "021.5".
+// Values that aren't numbers are returned unchanged.
+func pad(width int, value interface{}) string {
+	s := fmt.Sprint(value)
+	integer, decimal, hasDecimal := strings.Cut(s, ".")
+	if integer == "" || strings.Trim(integer, "0123456789") != "" {
+		return s
+	}
+	if len(integer) < width {
+		integer = strings.Repeat("0", width-len(integer)) + integer
+	}
+	if hasDecimal {
+		return integer + "." + decimal
+	}
+	return integer
+}
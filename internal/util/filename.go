@@ -0,0 +1,88 @@
+package util
+
+import (
+	"godex/internal/mangadex"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// invalidFilenameChars are rejected by Windows and by most NAS shares.
+const invalidFilenameChars = `<>:"/\|?*`
+
+// reservedFilenames can't be used as file names on Windows, whatever their extension.
+var reservedFilenames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeFilename turns a title into a name that is safe to use for a file or folder on any file system.
+// It normalizes the title, replaces invalid and control characters, trims trailing dots and spaces,
+// avoids reserved names and truncates the result to the maximum length.
+// It returns an empty string if nothing usable is left of the title.
+func SanitizeFilename(name string, cfg mangadex.FilenameConfig) string {
+	replacement := strings.Map(func(r rune) rune {
+		if isInvalidFilenameRune(r) {
+			return -1
+		}
+		return r
+	}, cfg.Replacement)
+
+	name = normalize(name, cfg.Normalization)
+
+	var b strings.Builder
+	for _, r := range name {
+		if isInvalidFilenameRune(r) {
+			b.WriteString(replacement)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	name = trimFilename(b.String())
+
+	if base, _, _ := strings.Cut(name, "."); reservedFilenames[strings.ToUpper(base)] {
+		name = replacement + name
+	}
+
+	if cfg.MaxLength > 0 && len(name) > cfg.MaxLength {
+		name = truncateUTF8(name, cfg.MaxLength)
+		name = trimFilename(name)
+	}
+	return name
+}
+
+// isInvalidFilenameRune checks if a character can't appear in a file name.
+func isInvalidFilenameRune(r rune) bool {
+	return r < 0x20 || r == 0x7f || strings.ContainsRune(invalidFilenameChars, r)
+}
+
+// trimFilename removes the leading spaces and the trailing dots and spaces that NAS shares choke on.
+func trimFilename(name string) string {
+	return strings.TrimRight(strings.TrimSpace(name), ". ")
+}
+
+// normalize applies the given Unicode normalization form, leaving the name untouched for unknown forms.
+func normalize(name string, form string) string {
+	switch strings.ToUpper(form) {
+	case "NFC":
+		return norm.NFC.String(name)
+	case "NFD":
+		return norm.NFD.String(name)
+	case "NFKC":
+		return norm.NFKC.String(name)
+	case "NFKD":
+		return norm.NFKD.String(name)
+	default:
+		return name
+	}
+}
+
+// truncateUTF8 cuts a string to at most maxBytes without splitting a character.
+func truncateUTF8(s string, maxBytes int) string {
+	for maxBytes > 0 && !utf8.RuneStart(s[maxBytes]) {
+		maxBytes--
+	}
+	return s[:maxBytes]
+}
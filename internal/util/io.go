@@ -1,14 +1,13 @@
 package util
 
 import (
-	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"godex/internal/mangadex"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"sort"
 )
 
 // CreateDownloadDir creates a directory for the download path.
@@ -26,99 +25,43 @@ func CreateDownloadDir(downloadPath string) error {
 	return err
 }
 
-// CreateMangaDir creates a directory for the manga.
-// It returns the path to the directory and nil if the directory is created successfully.
-// If the directory already exists, it returns the path to the directory and nil.
-// If there's an error, it returns nil and the error.
-func CreateMangaDir(downloadPath string, manga *mangadex.GodexManga) (string, error) {
-	folderPath := filepath.Join(downloadPath, manga.Manga.Attributes.Title.Values["en"])
-	err := os.Mkdir(folderPath, 0755)
-	if err != nil {
-		if os.IsExist(err) {
-			return folderPath, nil
-		}
-		return "", fmt.Errorf("error when creating manga directory: %v", err)
-	}
-	return folderPath, nil
+// PageFileName returns the name of a page image, padded so pages sort in reading order.
+func PageFileName(page int, ext string) string {
+	return fmt.Sprintf("%03d%s", page, ext)
 }
 
-// CreateCBZ creates a CBZ file from the chapter directory.
-// It sorts the files in the directory, creates a zip file, and copies the files into the zip file.
-// After the files are copied, it deletes the chapter directory and returns nil.
-// If there's an error, it returns the error.
-func CreateCBZ(chapterDir string) error {
-	files, err := os.ReadDir(chapterDir)
-	if err != nil {
-		return fmt.Errorf("failed to read directory: %w", err)
-	}
-
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].Name() < files[j].Name()
-	})
-
-	zipFile, err := os.Create(chapterDir + ".cbz")
-	if err != nil {
-		return fmt.Errorf("failed to create zip file: %w", err)
-	}
-	defer zipFile.Close()
-
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
-
-	for _, file := range files {
-		fileToZip, err := os.Open(filepath.Join(chapterDir, file.Name()))
-		if err != nil {
-			return fmt.Errorf("failed to open file: %w", err)
-		}
-		defer fileToZip.Close()
-
-		info, err := fileToZip.Stat()
-		if err != nil {
-			return fmt.Errorf("failed to get file info: %w", err)
-		}
-
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return fmt.Errorf("failed to create zip file header: %w", err)
-		}
-
-		header.Method = zip.Deflate
-
-		writer, err := zipWriter.CreateHeader(header)
-		if err != nil {
-			return fmt.Errorf("failed to create zip writer header: %w", err)
-		}
+// ChapterArchivePath returns the path of the archive with the given extension of the chapter at the given path relative to the download path.
+func ChapterArchivePath(downloadPath string, chapterPath string, extension string) string {
+	return filepath.Join(downloadPath, chapterPath) + extension
+}
 
-		_, err = io.Copy(writer, fileToZip)
-		if err != nil {
-			return fmt.Errorf("failed to copy file to zip: %w", err)
-		}
+// MoveFile moves a file to a new path, creating the missing directories.
+// The directory it was moved out of is removed if it ends up empty.
+func MoveFile(from string, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return fmt.Errorf("error creating directory for %v: %w", to, err)
 	}
-
-	// Delete the chapter directory
-	err = os.RemoveAll(chapterDir)
-	if err != nil {
-		return fmt.Errorf("failed to delete directory: %w", err)
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("error moving %v to %v: %w", from, to, err)
 	}
-
+	// Fails on purpose when the directory still holds other files
+	_ = os.Remove(filepath.Dir(from))
 	return nil
 }
 
-// CreateChapterDir creates a directory for the chapter.
-// It returns the path to the directory and nil if the directory is created successfully.
-// If there's an error, it returns an empty string and the error.
-func CreateChapterDir(mangaDir string, chapter *mangadex.Chapter) (string, error) {
-	folderPath := filepath.Join(mangaDir, *chapter.Attributes.Chapter)
-	err := os.Mkdir(folderPath, 0755)
+// HashFile returns the hex encoded SHA-256 of a file.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return "", fmt.Errorf("error when creating chapter directory: %v", err)
+		return "", err
 	}
-	return folderPath, nil
-}
+	defer file.Close()
 
-func CheckChapterAlreadyExists(mangaDir string, chapterNumber string) bool {
-	chapterFolderPath := filepath.Join(mangaDir, chapterNumber)
-	return CheckFileExists(chapterFolderPath + ".cbz")
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
 func CheckFileExists(path string) bool {